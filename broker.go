@@ -1,3 +1,44 @@
 package broker
 
-type broker interface{}
\ No newline at end of file
+import "context"
+
+// Broker is a message broker handler.
+// Application code should depend on this interface
+// instead of on a concrete transport implementation.
+type Broker interface {
+	// AddExchange declares an exchange in the broker.
+	AddExchange(name, kind string, durable, autodelete, internal, nowait bool) error
+	// AddQueue declares a queue in the broker.
+	AddQueue(name string, opts QueueOptions) error
+	// AddBinding binds a registered queue to a registered exchange.
+	AddBinding(exchange, queue, routingKey string, args map[string]interface{}) error
+	// AddEmitter registers a named emitter for an exchange.
+	AddEmitter(name, exchange string, queue ...string) error
+	// AddListener registers a named listener for an exchange and queue.
+	AddListener(name, exchange, queue string) error
+	// Publish sends a message through a registered emitter.
+	Publish(emitter, routingKey string, msg BaseMessage) error
+	// PublishContext is like Publish but gives up when ctx is done.
+	PublishContext(ctx context.Context, emitter, routingKey string, msg BaseMessage) error
+	// Subscribe passes messages received by a registered listener to a handler.
+	Subscribe(listener string, h Handler) error
+	// SubscribeContext is like Subscribe but handlers receive contexts
+	// derived from ctx and listener stops when it is done.
+	SubscribeContext(ctx context.Context, listener string, h Handler) error
+	// IsConnected returns true if broker connection is open.
+	IsConnected() bool
+	// Alive returns true while the handler has not been shut down.
+	Alive() bool
+	// Ready returns true if the handler can publish and consume.
+	Ready() bool
+	// Status returns a report of the handler state.
+	Status() Status
+	// Shutdown gracefully releases broker resources
+	// waiting for in-flight work until ctx is done.
+	Shutdown(ctx context.Context) error
+	// Close releases broker resources.
+	Close() error
+}
+
+// Handler processes a received message.
+type Handler func(ctx context.Context, msg BaseMessage) error
@@ -0,0 +1,110 @@
+package broker
+
+import "errors"
+
+// PermanentError is implemented by errors signaling
+// that a message will never be successfully handled
+// so it should not be delivered again.
+type PermanentError interface {
+	error
+	Permanent() bool
+}
+
+// RetryableError is implemented by errors signaling
+// that handling a message failed but it could succeed
+// if it is delivered again.
+type RetryableError interface {
+	error
+	Retryable() bool
+}
+
+type permanentError struct {
+	err error
+}
+
+type retryableError struct {
+	err error
+}
+
+// Permanent wraps err to mark it as permanent.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+// Retryable wraps err to mark it as retryable.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &retryableError{err: err}
+}
+
+// IsPermanent returns true if the outermost PermanentError or
+// RetryableError in err chain is a PermanentError reporting
+// itself as permanent.
+func IsPermanent(err error) bool {
+	permanent, _ := classify(err)
+	return permanent
+}
+
+// IsRetryable returns true if the outermost PermanentError or
+// RetryableError in err chain is a RetryableError reporting
+// itself as retryable.
+func IsRetryable(err error) bool {
+	_, retryable := classify(err)
+	return retryable
+}
+
+// classify looks for the first PermanentError and RetryableError
+// in err chain and reports the mark of the outermost one.
+func classify(err error) (permanent, retryable bool) {
+	var p PermanentError
+	var r RetryableError
+
+	hasP := errors.As(err, &p)
+	hasR := errors.As(err, &r)
+
+	switch {
+	case hasP && hasR && errors.Is(p, r):
+		// r is wrapped by p
+		return p.Permanent(), false
+
+	case hasR:
+		return false, r.Retryable()
+
+	case hasP:
+		return p.Permanent(), false
+
+	default:
+		return false, false
+	}
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func (e *permanentError) Permanent() bool {
+	return true
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+func (e *retryableError) Retryable() bool {
+	return true
+}
@@ -1,13 +1,24 @@
 module gitlab.com/mikrowezel/backend/broker
 
-go 1.12
+go 1.21
 
 require (
 	github.com/cenkalti/backoff v2.1.1+incompatible
-	github.com/google/uuid v1.1.1
+	github.com/google/uuid v1.6.0
 	github.com/mitchellh/mapstructure v1.1.2
 	github.com/streadway/amqp v0.0.0-20190404075320-75d898a42a94
 	gitlab.com/mikrowezel/backend/log v0.0.0
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/sdk v1.28.0
+	go.opentelemetry.io/otel/trace v1.28.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/rs/zerolog v1.14.3 // indirect
+	go.opentelemetry.io/otel/metric v1.28.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
 )
 
 replace gitlab.com/mikrowezel/backend/log => ../log
@@ -1,6 +1,17 @@
 package mapper
 
 // NewMessageMapper creates a new MessageMapper
+// that uses the package DefaultRegistry.
 func NewMessageMapper() BaseMessageMapper {
-	return &StaticMapper{}
+	return &StaticMapper{
+		Registry: DefaultRegistry,
+	}
+}
+
+// NewStaticMapper creates a new MessageMapper
+// that uses the provided registry.
+func NewStaticMapper(r *Registry) BaseMessageMapper {
+	return &StaticMapper{
+		Registry: r,
+	}
 }
@@ -4,18 +4,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
+	"sync"
 
 	"github.com/mitchellh/mapstructure"
 	"gitlab.com/mikrowezel/backend/broker"
 )
 
 // DynamicMapper is a dynamic mapper struct.
+// It is safe to register mappings while messages are being mapped.
 type DynamicMapper struct {
+	mutex   sync.RWMutex
 	typeMap map[string]reflect.Type
 }
 
 // NewDynamicMapper returns a new dynamic BaseMessageMapper.
-func NewDynamicMapper() BaseMessageMapper {
+func NewDynamicMapper() *DynamicMapper {
 	return &DynamicMapper{
 		typeMap: make(map[string]reflect.Type),
 	}
@@ -23,7 +27,10 @@ func NewDynamicMapper() BaseMessageMapper {
 
 // MapMessage maps broker messages to structs.
 func (e *DynamicMapper) MapMessage(messageTypeID string, serialized interface{}) (broker.BaseMessage, error) {
+	e.mutex.RLock()
 	eType, ok := e.typeMap[messageTypeID]
+	e.mutex.RUnlock()
+
 	if !ok {
 		return nil, fmt.Errorf("no mapping configured for message %s", messageTypeID)
 	}
@@ -64,14 +71,68 @@ func (e *DynamicMapper) MapMessage(messageTypeID string, serialized interface{})
 }
 
 // RegMapping let register a mapping.
+// messageType can be either a type whose pointer implements
+// the BaseMessage interface or the pointer type itself.
+// Mapping is registered under the type id returned by the message.
 func (e *DynamicMapper) RegMapping(messageType reflect.Type) error {
-	instance := reflect.New(messageType).Interface()
-	message, ok := instance.(broker.Message)
+	if messageType == nil {
+		return fmt.Errorf("nil message type")
+	}
 
+	if messageType.Kind() == reflect.Ptr {
+		messageType = messageType.Elem()
+	}
+
+	instance := reflect.New(messageType).Interface()
+	message, ok := instance.(broker.BaseMessage)
 	if !ok {
-		return fmt.Errorf("type %s does not implement the Message interface", instance)
+		return fmt.Errorf("type %s does not implement the Message interface", messageType)
 	}
 
-	e.typeMap[message.TypeID()] = messageType
+	typeID := message.TypeID()
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	registered, ok := e.typeMap[typeID]
+	if ok && registered != messageType {
+		return fmt.Errorf("message type '%s' already mapped to %s", typeID, registered)
+	}
+
+	e.typeMap[typeID] = messageType
 	return nil
 }
+
+// Unregister removes the mapping for a type id.
+// It returns false if there was no mapping registered.
+func (e *DynamicMapper) Unregister(typeID string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	_, ok := e.typeMap[typeID]
+	delete(e.typeMap, typeID)
+	return ok
+}
+
+// Has returns true if there is a mapping for the type id.
+func (e *DynamicMapper) Has(typeID string) bool {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	_, ok := e.typeMap[typeID]
+	return ok
+}
+
+// Types returns mapped type ids sorted alphabetically.
+func (e *DynamicMapper) Types() []string {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	types := make([]string, 0, len(e.typeMap))
+	for t := range e.typeMap {
+		types = append(types, t)
+	}
+
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,166 @@
+package mapper
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// otherOrder conflicts with order type id.
+type otherOrder struct{}
+
+func (o *otherOrder) TypeID() string { return "order" }
+
+type invoice struct {
+	Number string `json:"number"`
+}
+
+func (i *invoice) TypeID() string { return "invoice" }
+
+// notMessage does not implement broker.BaseMessage.
+type notMessage struct{}
+
+func TestDynamicMapperRegMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		types   []reflect.Type
+		wantErr bool
+	}{
+		{"value type", []reflect.Type{reflect.TypeOf(order{})}, false},
+		{"pointer type", []reflect.Type{reflect.TypeOf(&order{})}, false},
+		{"value and pointer", []reflect.Type{reflect.TypeOf(order{}), reflect.TypeOf(&order{})}, false},
+		{"conflicting type", []reflect.Type{reflect.TypeOf(order{}), reflect.TypeOf(otherOrder{})}, true},
+		{"not a message", []reflect.Type{reflect.TypeOf(notMessage{})}, true},
+		{"nil type", []reflect.Type{nil}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewDynamicMapper()
+
+			var err error
+			for _, typ := range tt.types {
+				err = m.RegMapping(typ)
+				if err != nil {
+					break
+				}
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RegMapping() error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			got, err := m.MapMessage("order", []byte(`{"id":"o-1","amount":2}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := &order{ID: "o-1", Amount: 2}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("MapMessage() = %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestDynamicMapperConflictKeepsMapping(t *testing.T) {
+	m := NewDynamicMapper()
+
+	if err := m.RegMapping(reflect.TypeOf(order{})); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RegMapping(reflect.TypeOf(otherOrder{})); err == nil {
+		t.Fatal("conflicting RegMapping() error = nil")
+	}
+
+	got, err := m.MapMessage("order", map[string]interface{}{"id": "o-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := got.(*order); !ok {
+		t.Errorf("MapMessage() = %T, want *order", got)
+	}
+}
+
+func TestDynamicMapperUnregister(t *testing.T) {
+	m := NewDynamicMapper()
+	m.RegMapping(reflect.TypeOf(order{}))
+	m.RegMapping(reflect.TypeOf(invoice{}))
+
+	want := []string{"invoice", "order"}
+	if got := m.Types(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Types() = %v, want %v", got, want)
+	}
+
+	if !m.Has("order") {
+		t.Error("Has(order) = false")
+	}
+
+	if !m.Unregister("order") {
+		t.Error("Unregister(order) = false")
+	}
+
+	if m.Unregister("order") {
+		t.Error("second Unregister(order) = true")
+	}
+
+	if m.Has("order") {
+		t.Error("Has(order) = true after Unregister")
+	}
+
+	if _, err := m.MapMessage("order", []byte(`{}`)); err == nil {
+		t.Error("MapMessage() of unregistered type error = nil")
+	}
+
+	// Type id can be mapped to another type once unregistered.
+	if err := m.RegMapping(reflect.TypeOf(otherOrder{})); err != nil {
+		t.Errorf("RegMapping() after Unregister error = %v", err)
+	}
+}
+
+func TestDynamicMapperConcurrent(t *testing.T) {
+	m := NewDynamicMapper()
+	m.RegMapping(reflect.TypeOf(order{}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				m.RegMapping(reflect.TypeOf(&invoice{}))
+				m.Unregister("invoice")
+				m.Types()
+			}
+		}()
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				id := fmt.Sprintf("o-%d-%d", i, j)
+				got, err := m.MapMessage("order", []byte(fmt.Sprintf(`{"id":%q}`, id)))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				if o := got.(*order); o.ID != id {
+					t.Errorf("MapMessage() id = %s, want %s", o.ID, id)
+					return
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
@@ -9,21 +9,17 @@ import (
 )
 
 // MapMessage decodes different serialized entities into a Message using the appropriate decoder.
-// TODO: Make types pluggable.
+// Messages are built using the constructors registered in the mapper Registry,
+// DefaultRegistry is used if none was set.
 func (sm *StaticMapper) MapMessage(messageTypeID string, serialized interface{}) (broker.BaseMessage, error) {
-	var bm broker.BaseMessage
-
-	// There will be a case for each broker BaseMessage concrete implementation.
-	// TODO: Make types pluggable.
-	switch messageTypeID {
-	case "message":
-		bm = &broker.Message{}
-
-	case "text":
-		bm = &broker.Text{}
+	reg := sm.Registry
+	if reg == nil {
+		reg = DefaultRegistry
+	}
 
-	default:
-		return nil, fmt.Errorf("unknown message type '%s'", messageTypeID)
+	bm, err := reg.New(messageTypeID)
+	if err != nil {
+		return nil, err
 	}
 
 	switch s := serialized.(type) {
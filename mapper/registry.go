@@ -0,0 +1,98 @@
+package mapper
+
+import (
+	"fmt"
+	"sort"
+
+	"gitlab.com/mikrowezel/backend/broker"
+)
+
+// DefaultRegistry is the package default registry.
+// It is used by mappers created through NewMessageMapper
+// and it comes with broker reference implementations
+// already registered.
+var DefaultRegistry = NewRegistry()
+
+func init() {
+	DefaultRegistry.MustRegister("message", func() broker.BaseMessage { return &broker.Message{} })
+	DefaultRegistry.MustRegister("text", func() broker.BaseMessage { return &broker.Text{} })
+}
+
+// NewRegistry returns a new empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		ctors: make(map[string]Constructor),
+	}
+}
+
+// Register a constructor for a message type id.
+// It returns an error if the type id is already registered.
+func (r *Registry) Register(typeID string, ctor Constructor) error {
+	if ctor == nil {
+		return fmt.Errorf("nil constructor for message type '%s'", typeID)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.ctors[typeID]; ok {
+		return fmt.Errorf("message type '%s' already registered", typeID)
+	}
+
+	r.ctors[typeID] = ctor
+	return nil
+}
+
+// MustRegister is like Register but panics if registration fails.
+func (r *Registry) MustRegister(typeID string, ctor Constructor) {
+	err := r.Register(typeID, ctor)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// New returns a new message for a type id.
+func (r *Registry) New(typeID string) (broker.BaseMessage, error) {
+	r.mutex.RLock()
+	ctor, ok := r.ctors[typeID]
+	r.mutex.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown message type '%s'", typeID)
+	}
+
+	return ctor(), nil
+}
+
+// Has returns true if type id is registered.
+func (r *Registry) Has(typeID string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	_, ok := r.ctors[typeID]
+	return ok
+}
+
+// Types returns registered type ids sorted alphabetically.
+func (r *Registry) Types() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	types := make([]string, 0, len(r.ctors))
+	for t := range r.ctors {
+		types = append(types, t)
+	}
+
+	sort.Strings(types)
+	return types
+}
+
+// Register a constructor for a message type id in the DefaultRegistry.
+func Register(typeID string, ctor Constructor) error {
+	return DefaultRegistry.Register(typeID, ctor)
+}
+
+// MustRegister is like Register but panics if registration fails.
+func MustRegister(typeID string, ctor Constructor) {
+	DefaultRegistry.MustRegister(typeID, ctor)
+}
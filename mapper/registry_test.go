@@ -0,0 +1,149 @@
+package mapper
+
+import (
+	"reflect"
+	"testing"
+
+	"gitlab.com/mikrowezel/backend/broker"
+)
+
+type order struct {
+	ID     string `json:"id"`
+	Amount int    `json:"amount"`
+}
+
+func (o *order) TypeID() string { return "order" }
+
+func newOrder() broker.BaseMessage { return &order{} }
+
+func TestRegistryRegister(t *testing.T) {
+	r := NewRegistry()
+
+	if err := r.Register("order", newOrder); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Register("order", newOrder); err == nil {
+		t.Error("duplicate Register() error = nil")
+	}
+
+	if err := r.Register("invoice", nil); err == nil {
+		t.Error("nil constructor Register() error = nil")
+	}
+
+	if !r.Has("order") || r.Has("invoice") {
+		t.Errorf("Has() order = %t, invoice = %t", r.Has("order"), r.Has("invoice"))
+	}
+
+	m, err := r.New("order")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := m.(*order); !ok {
+		t.Errorf("New() = %T, want *order", m)
+	}
+
+	if _, err := r.New("invoice"); err == nil {
+		t.Error("unknown type New() error = nil")
+	}
+}
+
+func TestRegistryMustRegister(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister("order", newOrder)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("duplicate MustRegister() did not panic")
+		}
+	}()
+
+	r.MustRegister("order", newOrder)
+}
+
+func TestRegistryTypes(t *testing.T) {
+	r := NewRegistry()
+	for _, id := range []string{"shipment", "order", "invoice"} {
+		r.MustRegister(id, newOrder)
+	}
+
+	want := []string{"invoice", "order", "shipment"}
+	if got := r.Types(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Types() = %v, want %v", got, want)
+	}
+
+	if got := NewRegistry().Types(); len(got) != 0 {
+		t.Errorf("empty Types() = %v", got)
+	}
+}
+
+func TestStaticMapper(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister("order", newOrder)
+
+	tests := []struct {
+		name       string
+		mapper     *StaticMapper
+		typeID     string
+		serialized interface{}
+		want       broker.BaseMessage
+		wantErr    bool
+	}{
+		{
+			name:       "json",
+			mapper:     &StaticMapper{Registry: r},
+			typeID:     "order",
+			serialized: []byte(`{"id":"o-1","amount":3}`),
+			want:       &order{ID: "o-1", Amount: 3},
+		},
+		{
+			name:       "map",
+			mapper:     &StaticMapper{Registry: r},
+			typeID:     "order",
+			serialized: map[string]interface{}{"id": "o-2", "amount": 5},
+			want:       &order{ID: "o-2", Amount: 5},
+		},
+		{
+			name:       "default registry",
+			mapper:     &StaticMapper{},
+			typeID:     "text",
+			serialized: []byte(`{"body":"hello"}`),
+			want:       &broker.Text{Body: "hello"},
+		},
+		{
+			name:       "not in default registry",
+			mapper:     &StaticMapper{},
+			typeID:     "order",
+			serialized: []byte(`{}`),
+			wantErr:    true,
+		},
+		{
+			name:       "unregistered",
+			mapper:     &StaticMapper{Registry: r},
+			typeID:     "text",
+			serialized: []byte(`{}`),
+			wantErr:    true,
+		},
+		{
+			name:       "invalid json",
+			mapper:     &StaticMapper{Registry: r},
+			typeID:     "order",
+			serialized: []byte(`{`),
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.mapper.MapMessage(tt.typeID, tt.serialized)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MapMessage() error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MapMessage() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,4 +1,23 @@
 package mapper
 
+import (
+	"sync"
+
+	"gitlab.com/mikrowezel/backend/broker"
+)
+
 // StaticMapper is a broker static mapper.
-type StaticMapper struct{}
+// It builds messages using the constructors
+// registered in its Registry.
+type StaticMapper struct {
+	Registry *Registry
+}
+
+// Constructor returns a new zero value message.
+type Constructor func() broker.BaseMessage
+
+// Registry holds message constructors by type id.
+type Registry struct {
+	mutex sync.RWMutex
+	ctors map[string]Constructor
+}
@@ -0,0 +1,21 @@
+package metrics
+
+import "time"
+
+// Metrics records broker activity.
+type Metrics interface {
+	// MessageEmitted counts a message published to an exchange.
+	MessageEmitted(exchange, typeID string)
+	// EmitFailed counts a message that could not be published.
+	EmitFailed(exchange, typeID string)
+	// ConfirmNacked counts a message negatively acknowledged by the broker.
+	ConfirmNacked(exchange string)
+	// MessageConsumed counts a message received from a queue.
+	MessageConsumed(queue, typeID string)
+	// DecodeFailed counts a message the mapper could not decode.
+	DecodeFailed(queue, typeID string)
+	// MessageHandled records handler latency and outcome.
+	MessageHandled(queue, typeID string, d time.Duration, err error)
+	// Reconnected counts a recovered broker connection.
+	Reconnected()
+}
@@ -0,0 +1,33 @@
+package metrics
+
+// DefaultBuckets are the handler latency histogram
+// upper bounds in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// NewNop returns a Metrics that records nothing.
+func NewNop() Metrics {
+	return Nop{}
+}
+
+// NewPrometheus returns a new Prometheus metrics recorder.
+// Metric names are prefixed by namespace, "broker" is used if empty.
+func NewPrometheus(namespace string) *Prometheus {
+	if namespace == "" {
+		namespace = "broker"
+	}
+
+	n := func(name string) string {
+		return namespace + "_" + name
+	}
+
+	return &Prometheus{
+		emitted:          newCounterVec(n("messages_emitted_total"), "Messages published to an exchange.", "exchange", "type"),
+		emitErrors:       newCounterVec(n("emit_errors_total"), "Messages that could not be published.", "exchange", "type"),
+		nacked:           newCounterVec(n("confirms_nacked_total"), "Messages negatively acknowledged by the broker.", "exchange"),
+		consumed:         newCounterVec(n("messages_consumed_total"), "Messages received from a queue.", "queue", "type"),
+		decodeErrors:     newCounterVec(n("decode_errors_total"), "Messages that could not be decoded.", "queue", "type"),
+		handlerErrors:    newCounterVec(n("handler_errors_total"), "Messages whose handler failed.", "queue", "type"),
+		handlerDurations: newHistogramVec(n("handler_duration_seconds"), "Message handler latency.", DefaultBuckets, "queue", "type"),
+		reconnects:       newCounterVec(n("reconnects_total"), "Recovered broker connections."),
+	}
+}
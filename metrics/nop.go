@@ -0,0 +1,24 @@
+package metrics
+
+import "time"
+
+// MessageEmitted does nothing.
+func (Nop) MessageEmitted(exchange, typeID string) {}
+
+// EmitFailed does nothing.
+func (Nop) EmitFailed(exchange, typeID string) {}
+
+// ConfirmNacked does nothing.
+func (Nop) ConfirmNacked(exchange string) {}
+
+// MessageConsumed does nothing.
+func (Nop) MessageConsumed(queue, typeID string) {}
+
+// DecodeFailed does nothing.
+func (Nop) DecodeFailed(queue, typeID string) {}
+
+// MessageHandled does nothing.
+func (Nop) MessageHandled(queue, typeID string, d time.Duration, err error) {}
+
+// Reconnected does nothing.
+func (Nop) Reconnected() {}
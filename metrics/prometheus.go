@@ -0,0 +1,226 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MessageEmitted counts a message published to an exchange.
+func (p *Prometheus) MessageEmitted(exchange, typeID string) {
+	p.emitted.inc(exchange, typeID)
+}
+
+// EmitFailed counts a message that could not be published.
+func (p *Prometheus) EmitFailed(exchange, typeID string) {
+	p.emitErrors.inc(exchange, typeID)
+}
+
+// ConfirmNacked counts a message negatively acknowledged by the broker.
+func (p *Prometheus) ConfirmNacked(exchange string) {
+	p.nacked.inc(exchange)
+}
+
+// MessageConsumed counts a message received from a queue.
+func (p *Prometheus) MessageConsumed(queue, typeID string) {
+	p.consumed.inc(queue, typeID)
+}
+
+// DecodeFailed counts a message the mapper could not decode.
+func (p *Prometheus) DecodeFailed(queue, typeID string) {
+	p.decodeErrors.inc(queue, typeID)
+}
+
+// MessageHandled records handler latency and outcome.
+func (p *Prometheus) MessageHandled(queue, typeID string, d time.Duration, err error) {
+	p.handlerDurations.observe(d.Seconds(), queue, typeID)
+	if err != nil {
+		p.handlerErrors.inc(queue, typeID)
+	}
+}
+
+// Reconnected counts a recovered broker connection.
+func (p *Prometheus) Reconnected() {
+	p.reconnects.inc()
+}
+
+// ServeHTTP writes recorded values using Prometheus text exposition format.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.Write(w)
+}
+
+// Write writes recorded values to w using Prometheus text exposition format.
+func (p *Prometheus) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	p.emitted.write(bw)
+	p.emitErrors.write(bw)
+	p.nacked.write(bw)
+	p.consumed.write(bw)
+	p.decodeErrors.write(bw)
+	p.handlerErrors.write(bw)
+	p.handlerDurations.write(bw)
+	p.reconnects.write(bw)
+
+	return bw.Flush()
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	c := &counterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]*counter),
+	}
+
+	// Counters without labels are exposed from the start.
+	if len(labels) == 0 {
+		c.values[""] = &counter{}
+	}
+
+	return c
+}
+
+func (c *counterVec) inc(labels ...string) {
+	key := strings.Join(labels, "\xff")
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	v, ok := c.values[key]
+	if !ok {
+		v = &counter{labels: labels}
+		c.values[key] = v
+	}
+
+	v.value++
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", c.name, c.help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", c.name)
+
+	for _, k := range sortedKeys(c.values) {
+		v := c.values[k]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labelPairs(c.labels, v.labels), formatFloat(v.value))
+	}
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		values:  make(map[string]*histogram),
+	}
+}
+
+func (h *histogramVec) observe(value float64, labels ...string) {
+	key := strings.Join(labels, "\xff")
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	v, ok := h.values[key]
+	if !ok {
+		v = &histogram{
+			labels: labels,
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = v
+	}
+
+	for i, b := range h.buckets {
+		if value <= b {
+			v.counts[i]++
+		}
+	}
+
+	v.count++
+	v.sum += value
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", h.name, h.help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", h.name)
+
+	labels := append(append([]string{}, h.labels...), "le")
+
+	for _, k := range sortedKeys(h.values) {
+		v := h.values[k]
+
+		for i, b := range h.buckets {
+			values := append(append([]string{}, v.labels...), formatFloat(b))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(labels, values), v.counts[i])
+		}
+
+		values := append(append([]string{}, v.labels...), "+Inf")
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(labels, values), v.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelPairs(h.labels, v.labels), formatFloat(v.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelPairs(h.labels, v.labels), v.count)
+	}
+}
+
+// labelPairs returns names and values formatted as
+// a Prometheus label set, empty if there are no labels.
+func labelPairs(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, n := range names {
+		pairs[i] = n + `="` + escape(values[i]) + `"`
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+
+	switch v := m.(type) {
+	case map[string]*counter:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[string]*histogram:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func exposition(t *testing.T, p *Prometheus) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	err := p.Write(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.String()
+}
+
+func assertLines(t *testing.T, out string, lines ...string) {
+	t.Helper()
+
+	for _, l := range lines {
+		if !strings.Contains(out, l+"\n") {
+			t.Errorf("missing line %q in:\n%s", l, out)
+		}
+	}
+}
+
+func TestPrometheusNamespace(t *testing.T) {
+	out := exposition(t, NewPrometheus("app"))
+
+	assertLines(t, out,
+		"# HELP app_messages_emitted_total Messages published to an exchange.",
+		"# TYPE app_messages_emitted_total counter",
+		"# TYPE app_handler_duration_seconds histogram",
+	)
+}
+
+func TestPrometheusReconnectsStartAtZero(t *testing.T) {
+	p := NewPrometheus("")
+
+	assertLines(t, exposition(t, p), "broker_reconnects_total 0")
+
+	p.Reconnected()
+	p.Reconnected()
+
+	assertLines(t, exposition(t, p), "broker_reconnects_total 2")
+}
+
+func TestPrometheusCounters(t *testing.T) {
+	p := NewPrometheus("")
+
+	p.MessageEmitted("events", "order.created")
+	p.MessageEmitted("events", "order.created")
+	p.MessageEmitted("events", "order.paid")
+	p.EmitFailed("events", "order.paid")
+	p.ConfirmNacked("events")
+	p.MessageConsumed("orders", "order.created")
+	p.DecodeFailed("orders", "order.created")
+
+	assertLines(t, exposition(t, p),
+		`broker_messages_emitted_total{exchange="events",type="order.created"} 2`,
+		`broker_messages_emitted_total{exchange="events",type="order.paid"} 1`,
+		`broker_emit_errors_total{exchange="events",type="order.paid"} 1`,
+		`broker_confirms_nacked_total{exchange="events"} 1`,
+		`broker_messages_consumed_total{queue="orders",type="order.created"} 1`,
+		`broker_decode_errors_total{queue="orders",type="order.created"} 1`,
+	)
+}
+
+func TestPrometheusLabelEscaping(t *testing.T) {
+	p := NewPrometheus("")
+
+	p.MessageEmitted("a\"b\\c\nd", "t")
+
+	assertLines(t, exposition(t, p),
+		`broker_messages_emitted_total{exchange="a\"b\\c\nd",type="t"} 1`,
+	)
+}
+
+func TestPrometheusHistogram(t *testing.T) {
+	p := NewPrometheus("")
+
+	p.MessageHandled("orders", "order.created", 3*time.Millisecond, nil)
+	p.MessageHandled("orders", "order.created", 200*time.Millisecond, errors.New("failed"))
+	p.MessageHandled("orders", "order.created", 20*time.Second, nil)
+
+	const labels = `queue="orders",type="order.created"`
+
+	assertLines(t, exposition(t, p),
+		`broker_handler_duration_seconds_bucket{`+labels+`,le="0.005"} 1`,
+		`broker_handler_duration_seconds_bucket{`+labels+`,le="0.1"} 1`,
+		`broker_handler_duration_seconds_bucket{`+labels+`,le="0.25"} 2`,
+		`broker_handler_duration_seconds_bucket{`+labels+`,le="10"} 2`,
+		`broker_handler_duration_seconds_bucket{`+labels+`,le="+Inf"} 3`,
+		`broker_handler_duration_seconds_sum{`+labels+`} 20.203`,
+		`broker_handler_duration_seconds_count{`+labels+`} 3`,
+		`broker_handler_errors_total{`+labels+`} 1`,
+	)
+}
+
+func TestPrometheusServeHTTP(t *testing.T) {
+	p := NewPrometheus("")
+	p.Reconnected()
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type = %s", ct)
+	}
+
+	assertLines(t, rec.Body.String(), "broker_reconnects_total 1")
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import "sync"
+
+// Nop is a Metrics implementation that records nothing.
+type Nop struct{}
+
+// Prometheus is a Metrics implementation that serves
+// recorded values using Prometheus text exposition format.
+type Prometheus struct {
+	emitted          *counterVec
+	emitErrors       *counterVec
+	nacked           *counterVec
+	consumed         *counterVec
+	decodeErrors     *counterVec
+	handlerErrors    *counterVec
+	handlerDurations *histogramVec
+	reconnects       *counterVec
+}
+
+type counterVec struct {
+	mutex  sync.Mutex
+	name   string
+	help   string
+	labels []string
+	values map[string]*counter
+}
+
+type counter struct {
+	labels []string
+	value  float64
+}
+
+type histogramVec struct {
+	mutex   sync.Mutex
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
@@ -0,0 +1,197 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/streadway/amqp"
+	"gitlab.com/mikrowezel/backend/broker"
+)
+
+// AckMode defines how listener deliveries are acknowledged.
+type AckMode int
+
+const (
+	// AckOnReturn acknowledges deliveries according to the
+	// handler result: a nil error acks, a retryable one nacks
+	// with requeue and a permanent one rejects.
+	AckOnReturn AckMode = iota
+	// AckAuto lets the broker consider deliveries
+	// acknowledged as soon as they are sent.
+	AckAuto
+	// AckManual leaves acknowledgement to the handler
+	// through the DeliveryHandle in its context.
+	AckManual
+)
+
+// Disposition is the outcome of a failed delivery.
+type Disposition int
+
+const (
+	// DispositionRetry delivers the message again, using
+	// the listener retry policy if there is one.
+	DispositionRetry Disposition = iota
+	// DispositionReject rejects the message without requeue
+	// so that it is dead-lettered if possible.
+	DispositionReject
+	// DispositionAck acknowledges the message despite the error.
+	DispositionAck
+)
+
+// Classifier returns the disposition for a handler error.
+type Classifier func(err error) Disposition
+
+// ErrAlreadySettled is returned when a delivery
+// is acknowledged more than once.
+var ErrAlreadySettled = errors.New("delivery already settled")
+
+// DefaultClassifier retries errors marked as retryable and rejects
+// those marked as permanent, if an error has both the outermost
+// mark wins. Unclassified errors, those implementing neither
+// broker.RetryableError nor broker.PermanentError, are assumed
+// to be transient and retried.
+func DefaultClassifier(err error) Disposition {
+	switch {
+	case broker.IsRetryable(err):
+		return DispositionRetry
+
+	case broker.IsPermanent(err):
+		return DispositionReject
+
+	default:
+		return DispositionRetry
+	}
+}
+
+// AckMode returns the default listener acknowledgement mode:
+// "return", "auto" or "manual".
+func (cfg *Config) AckMode() AckMode {
+	switch cfg.ValAsString("rabbitmq.listener.ackmode", "return") {
+	case "auto":
+		return AckAuto
+	case "manual":
+		return AckManual
+	default:
+		return AckOnReturn
+	}
+}
+
+// SetAckMode sets listener acknowledgement mode.
+// It must be set before listening.
+func (l *Listener) SetAckMode(mode AckMode) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.ackMode = mode
+}
+
+// SetClassifier sets the function used in AckOnReturn mode
+// to decide the disposition of failed deliveries.
+func (l *Listener) SetClassifier(c Classifier) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.classifier = c
+}
+
+// DeliveryHandle lets handlers explicitly
+// acknowledge the delivery being handled.
+// Only the first call to any of its methods takes effect.
+type DeliveryHandle struct {
+	mutex    sync.Mutex
+	delivery amqp.Delivery
+	settled  bool
+}
+
+// HandleFromContext returns the delivery handle passed
+// to a handler by a listener in AckManual mode.
+func HandleFromContext(ctx context.Context) (*DeliveryHandle, bool) {
+	h, ok := ctx.Value(handleCtxKey).(*DeliveryHandle)
+	return h, ok
+}
+
+// Ack acknowledges the delivery.
+func (h *DeliveryHandle) Ack() error {
+	return h.settle(func(d amqp.Delivery) error {
+		return d.Ack(false)
+	})
+}
+
+// Nack negatively acknowledges the delivery.
+func (h *DeliveryHandle) Nack(requeue bool) error {
+	return h.settle(func(d amqp.Delivery) error {
+		return d.Nack(false, requeue)
+	})
+}
+
+// Reject rejects the delivery.
+func (h *DeliveryHandle) Reject(requeue bool) error {
+	return h.settle(func(d amqp.Delivery) error {
+		return d.Reject(requeue)
+	})
+}
+
+// Settled returns true if the delivery was already acknowledged.
+func (h *DeliveryHandle) Settled() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.settled
+}
+
+func (h *DeliveryHandle) settle(fn func(amqp.Delivery) error) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.settled {
+		return ErrAlreadySettled
+	}
+
+	h.settled = true
+	return fn(h.delivery)
+}
+
+func withHandle(ctx context.Context, h *DeliveryHandle) context.Context {
+	return context.WithValue(ctx, handleCtxKey, h)
+}
+
+// settle acknowledges a delivery in AckOnReturn mode
+// according to its handler result.
+func (l *Listener) settle(d amqp.Delivery, err error) {
+	if err == nil {
+		d.Ack(false)
+		return
+	}
+
+	l.mutex.RLock()
+	classify := l.classifier
+	l.mutex.RUnlock()
+
+	if classify == nil {
+		classify = DefaultClassifier
+	}
+
+	switch classify(err) {
+	case DispositionAck:
+		d.Ack(false)
+
+	case DispositionReject:
+		d.Reject(false)
+
+	default:
+		retried, err := l.retry(d)
+		if err != nil {
+			l.log.Error(err, "Cannot schedule message retry", "queue", l.queue, "type", typeID(d))
+			d.Nack(false, true)
+			return
+		}
+
+		if retried {
+			d.Ack(false)
+			return
+		}
+
+		d.Nack(false, true)
+	}
+}
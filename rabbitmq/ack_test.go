@@ -0,0 +1,45 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"gitlab.com/mikrowezel/backend/broker"
+)
+
+type wrapped struct {
+	err error
+}
+
+func (w *wrapped) Error() string { return fmt.Sprintf("wrapped: %s", w.err) }
+
+func (w *wrapped) Unwrap() error { return w.err }
+
+func TestDefaultClassifier(t *testing.T) {
+	base := errors.New("failure")
+
+	tests := []struct {
+		name string
+		err  error
+		want Disposition
+	}{
+		{"unclassified", base, DispositionRetry},
+		{"retryable", broker.Retryable(base), DispositionRetry},
+		{"permanent", broker.Permanent(base), DispositionReject},
+		{"wrapped permanent", &wrapped{broker.Permanent(base)}, DispositionReject},
+		{"wrapped retryable", &wrapped{broker.Retryable(base)}, DispositionRetry},
+		{"retryable permanent", broker.Retryable(broker.Permanent(base)), DispositionRetry},
+		{"permanent retryable", broker.Permanent(broker.Retryable(base)), DispositionReject},
+		{"wrapped permanent retryable", &wrapped{broker.Permanent(&wrapped{broker.Retryable(base)})}, DispositionReject},
+		{"joined", errors.Join(base, broker.Permanent(base)), DispositionReject},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultClassifier(tt.err); got != tt.want {
+				t.Errorf("DefaultClassifier() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
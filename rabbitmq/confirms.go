@@ -0,0 +1,223 @@
+package rabbitmq
+
+import (
+	"errors"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+var (
+	// ErrNacked is returned when the broker
+	// negatively acknowledges a published message.
+	ErrNacked = errors.New("message nacked by broker")
+	// ErrConfirmTimeout is returned when the broker
+	// does not confirm a published message in time.
+	ErrConfirmTimeout = errors.New("message confirmation timeout")
+	// ErrChannelClosed is returned when the channel a message
+	// was published on is closed before it was confirmed.
+	ErrChannelClosed = errors.New("channel closed before confirmation")
+)
+
+// SetConfirm puts emitter in confirm mode.
+// In this mode a message is considered emitted only
+// after the broker acknowledges it, emits that are not
+// confirmed before timeout fail with ErrConfirmTimeout.
+// A zero timeout disables confirm mode.
+func (e *Emitter) SetConfirm(timeout time.Duration) {
+	e.mutex.Lock()
+	e.confirmTimeout = timeout
+	e.mutex.Unlock()
+
+	// Next publication opens a channel in the new mode.
+	e.resetChannel()
+}
+
+// IsConfirming returns true if emitter is in confirm mode.
+func (e *Emitter) IsConfirming() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.confirmTimeout > 0
+}
+
+func newConfirmTracker(timeout time.Duration) *confirmTracker {
+	return &confirmTracker{
+		timeout: timeout,
+		pending: make(map[uint64]*EmittedBaseMessage),
+	}
+}
+
+// add registers a message that is about to be published
+// and returns the delivery tag it will be assigned.
+func (t *confirmTracker) add(ebm *EmittedBaseMessage) uint64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.tag++
+	tag := t.tag
+	t.pending[tag] = ebm
+
+	ebm.timer = time.AfterFunc(t.timeout, func() {
+		t.resolve(tag, ErrConfirmTimeout)
+	})
+
+	return tag
+}
+
+// discard forgets a message whose publication failed.
+func (t *confirmTracker) discard(tag uint64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// The tag is reused, its timer must not fire for the next message.
+	if ebm, ok := t.pending[tag]; ok {
+		ebm.timer.Stop()
+	}
+
+	delete(t.pending, tag)
+	t.tag--
+}
+
+// resolve reports the outcome of a pending message.
+func (t *confirmTracker) resolve(tag uint64, err error) {
+	t.mutex.Lock()
+	ebm, ok := t.pending[tag]
+	delete(t.pending, tag)
+	t.mutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	ebm.timer.Stop()
+
+	if err == nil && ebm.returned != nil {
+		err = ebm.returned
+	}
+
+	ebm.resolve(err)
+}
+
+// waiting returns the number of messages waiting for confirmation.
+func (t *confirmTracker) waiting() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return len(t.pending)
+}
+
+// listen resolves pending messages as confirmations arrive.
+// Returned messages arrive before their confirmation, they
+// are marked so that their emission fails with ErrUnroutable.
+// Those that cannot be correlated are passed to onReturn
+// on its own goroutine so that confirmations are not delayed.
+// When the channel is closed remaining messages fail.
+func (t *confirmTracker) listen(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return, onReturn func(*ErrUnroutable)) {
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+
+			t.returned(ret, onReturn)
+
+		case c, ok := <-confirms:
+			if !ok {
+				t.failPending()
+				return
+			}
+
+			// A return is queued before the confirmation that
+			// follows it, drain them so it is not missed.
+			returns = t.drainReturns(returns, onReturn)
+
+			if c.Ack {
+				t.resolve(c.DeliveryTag, nil)
+				continue
+			}
+
+			t.resolve(c.DeliveryTag, ErrNacked)
+		}
+	}
+}
+
+// returned marks the pending message a return belongs to
+// or passes it to onReturn if there is none.
+func (t *confirmTracker) returned(ret amqp.Return, onReturn func(*ErrUnroutable)) {
+	err := unroutable(ret)
+	if !t.markReturned(err) {
+		go onReturn(err)
+	}
+}
+
+// drainReturns processes the returns already queued.
+// It returns nil if returns channel was closed.
+func (t *confirmTracker) drainReturns(returns <-chan amqp.Return, onReturn func(*ErrUnroutable)) <-chan amqp.Return {
+	for returns != nil {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				return nil
+			}
+
+			t.returned(ret, onReturn)
+
+		default:
+			return returns
+		}
+	}
+
+	return nil
+}
+
+// markReturned sets the return error of the pending message
+// it belongs to, it returns false if there is none.
+func (t *confirmTracker) markReturned(err *ErrUnroutable) bool {
+	if err.MessageID == "" {
+		return false
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, ebm := range t.pending {
+		if ebm.messageID == err.MessageID {
+			ebm.returned = err
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *confirmTracker) failPending() {
+	t.mutex.Lock()
+	pending := t.pending
+	t.pending = make(map[uint64]*EmittedBaseMessage)
+	t.mutex.Unlock()
+
+	for _, ebm := range pending {
+		ebm.timer.Stop()
+		ebm.resolve(ErrChannelClosed)
+	}
+}
+
+// resolve reports the outcome of the emission.
+// Only the first reported outcome is taken into account.
+func (ebm *EmittedBaseMessage) resolve(err error) {
+	ebm.once.Do(func() {
+		if ebm.emitter != nil {
+			ebm.emitter.record(ebm, err)
+		}
+
+		if ebm.span != nil {
+			spanError(ebm.span, err)
+			ebm.span.End()
+		}
+
+		ebm.errorChan <- err
+	})
+}
@@ -0,0 +1,213 @@
+package rabbitmq
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// trackerOp is a step fed to a confirm tracker, only one field is set.
+type trackerOp struct {
+	add          string
+	discard      string
+	ack          uint64
+	nack         uint64
+	ret          string
+	closeReturns bool
+	close        bool
+}
+
+func TestConfirmTracker(t *testing.T) {
+	unroutableErr := &ErrUnroutable{}
+
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		ops      []trackerOp
+		want     map[string]error
+		unrouted []string
+	}{
+		{
+			name: "ack and nack",
+			ops: []trackerOp{
+				{add: "a"}, {add: "b"}, {add: "c"},
+				{ack: 2}, {nack: 1}, {ack: 3},
+			},
+			want: map[string]error{"a": ErrNacked, "b": nil, "c": nil},
+		},
+		{
+			name: "discarded tag is reused",
+			ops: []trackerOp{
+				{add: "a"}, {add: "b"}, {discard: "b"}, {add: "c"},
+				{ack: 1}, {nack: 2}, {close: true},
+			},
+			want: map[string]error{"a": nil, "c": ErrNacked},
+		},
+		{
+			name:    "timeout",
+			timeout: 10 * time.Millisecond,
+			ops:     []trackerOp{{add: "a"}},
+			want:    map[string]error{"a": ErrConfirmTimeout},
+		},
+		{
+			name: "returned before confirm",
+			ops: []trackerOp{
+				{add: "a"}, {add: "b"},
+				{ret: "a"}, {ack: 1}, {ack: 2},
+			},
+			want: map[string]error{"a": unroutableErr, "b": nil},
+		},
+		{
+			name: "nack wins over return",
+			ops: []trackerOp{
+				{add: "a"}, {ret: "a"}, {nack: 1},
+			},
+			want: map[string]error{"a": ErrNacked},
+		},
+		{
+			name: "uncorrelated returns",
+			ops: []trackerOp{
+				{add: "a"}, {ret: "z"}, {ret: ""}, {ack: 1},
+			},
+			want:     map[string]error{"a": nil},
+			unrouted: []string{"z", ""},
+		},
+		{
+			name: "returns closed",
+			ops: []trackerOp{
+				{add: "a"}, {closeReturns: true}, {ack: 1},
+			},
+			want: map[string]error{"a": nil},
+		},
+		{
+			name: "channel closed",
+			ops: []trackerOp{
+				{add: "a"}, {add: "b"}, {ack: 1}, {close: true},
+			},
+			want: map[string]error{"a": nil, "b": ErrChannelClosed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeout := tt.timeout
+			if timeout == 0 {
+				timeout = time.Minute
+			}
+
+			tr := newConfirmTracker(timeout)
+			confirms := make(chan amqp.Confirmation, len(tt.ops))
+			returns := make(chan amqp.Return, len(tt.ops))
+			unrouted := make(chan *ErrUnroutable, len(tt.ops))
+			done := make(chan struct{})
+
+			go func() {
+				tr.listen(confirms, returns, func(err *ErrUnroutable) { unrouted <- err })
+				close(done)
+			}()
+
+			msgs := map[string]*EmittedBaseMessage{}
+			tags := map[string]uint64{}
+
+			for _, op := range tt.ops {
+				switch {
+				case op.add != "":
+					ebm := &EmittedBaseMessage{messageID: op.add, errorChan: make(chan error, 1)}
+					msgs[op.add] = ebm
+					tags[op.add] = tr.add(ebm)
+
+				case op.discard != "":
+					tr.discard(tags[op.discard])
+
+				case op.ack > 0:
+					confirms <- amqp.Confirmation{DeliveryTag: op.ack, Ack: true}
+
+				case op.nack > 0:
+					confirms <- amqp.Confirmation{DeliveryTag: op.nack}
+
+				case op.closeReturns:
+					close(returns)
+
+				case op.close:
+					close(confirms)
+
+				default:
+					returns <- amqp.Return{MessageId: op.ret, ReplyCode: amqp.NoRoute}
+				}
+			}
+
+			for id, want := range tt.want {
+				select {
+				case err := <-msgs[id].errorChan:
+					checkOutcome(t, id, err, want)
+
+				case <-time.After(time.Second):
+					t.Errorf("message %s not resolved", id)
+				}
+			}
+
+			for id, ebm := range msgs {
+				if _, ok := tt.want[id]; ok {
+					continue
+				}
+
+				select {
+				case err := <-ebm.errorChan:
+					t.Errorf("message %s resolved with %v, want unresolved", id, err)
+				default:
+				}
+			}
+
+			var got []string
+			for range tt.unrouted {
+				select {
+				case err := <-unrouted:
+					got = append(got, err.MessageID)
+
+				case <-time.After(time.Second):
+				}
+			}
+
+			sort.Strings(got)
+			sort.Strings(tt.unrouted)
+			if !reflect.DeepEqual(got, tt.unrouted) {
+				t.Errorf("unrouted returns = %q, want %q", got, tt.unrouted)
+			}
+
+			if n := tr.waiting(); n != 0 {
+				t.Errorf("waiting() = %d, want 0", n)
+			}
+
+			if !tt.ops[len(tt.ops)-1].close {
+				close(confirms)
+			}
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Error("listen did not return after channel close")
+			}
+		})
+	}
+}
+
+func checkOutcome(t *testing.T, id string, got, want error) {
+	t.Helper()
+
+	var wantUnroutable *ErrUnroutable
+	if !errors.As(want, &wantUnroutable) {
+		if got != want {
+			t.Errorf("message %s resolved with %v, want %v", id, got, want)
+		}
+		return
+	}
+
+	var u *ErrUnroutable
+	if !errors.As(got, &u) || u.MessageID != id || u.ReplyCode != amqp.NoRoute {
+		t.Errorf("message %s resolved with %v, want unroutable", id, got)
+	}
+}
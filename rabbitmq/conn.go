@@ -1,14 +1,19 @@
 package rabbitmq
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/cenkalti/backoff"
-	"github.com/google/uuid"
 	"github.com/streadway/amqp"
 )
 
+// channelRetryInterval is the time RetryChannel
+// waits between channel opening attempts.
+const channelRetryInterval = 500 * time.Millisecond
+
 // Connection tries to establish a connection to RabbitMQ.
 // error if fails.
 func (r *RabbitMQ) Connection() (*amqp.Connection, error) {
@@ -20,6 +25,8 @@ func (r *RabbitMQ) Connection() (*amqp.Connection, error) {
 // RetryConnection implements a backoff mechanism for establishing a connection
 // to RabbitMQ; this is especially useful in containerize environments where
 // components can be started out of order.
+// Retries are interrupted if handler context is done
+// or the handler is shut down.
 func (r *RabbitMQ) RetryConnection() chan *amqp.Connection {
 	result := make(chan *amqp.Connection)
 
@@ -53,41 +60,78 @@ func (r *RabbitMQ) RetryConnection() chan *amqp.Connection {
 			}
 
 			r.log.Info("Rabbit connection failed", "retrying-in", nb.String(), "unit", "seconds")
-			time.Sleep(nb)
+
+			select {
+			case <-time.After(nb):
+
+			case <-r.ctx.Done():
+				result <- nil
+				r.log.Info("Rabbit connection failed", "reason", "context done")
+				return
+
+			case <-r.done:
+				result <- nil
+				r.log.Info("Rabbit connection failed", "reason", "handler shut down")
+				return
+			}
 		}
 	}()
 
 	return result
 }
 
-// RetryChannel until get a healty one
+// RetryChannel tries to open a channel until it gets a healthy one
+// or timeoutMillis elapse, in which case an error is sent instead.
+// Returned channel is not taken from the handler pool,
+// callers own it and must close it.
+//
+// Deprecated: use Channel, which checks out a pooled channel
+// that must be given back using ReleaseChannel.
 func (r *RabbitMQ) RetryChannel(timeoutMillis int) (chan *Channel, chan error) {
-	result := make(chan *Channel)
-	errs := make(chan error)
+	return r.RetryChannelContext(r.ctx, timeoutMillis)
+}
+
+// RetryChannelContext is like RetryChannel but it also
+// gives up when ctx is done.
+//
+// Deprecated: use ChannelContext.
+func (r *RabbitMQ) RetryChannelContext(ctx context.Context, timeoutMillis int) (chan *Channel, chan error) {
+	result := make(chan *Channel, 1)
+	errs := make(chan error, 1)
 
 	go func() {
 		defer close(result)
 
-		for {
-			ch, err := r.conn.Channel()
+		timeout := time.After(time.Duration(timeoutMillis) * time.Millisecond)
 
-			channel := Channel{
-				ID:      uuid.New(),
-				Name:    "",
-				Channel: ch,
-				IsOpen:  true,
+		for {
+			r.mutex.RLock()
+			conn := r.conn
+			r.mutex.RUnlock()
+
+			err := errors.New("no active connection")
+			if conn != nil && !conn.IsClosed() {
+				var ch *amqp.Channel
+				ch, err = conn.Channel()
+				if err == nil {
+					result <- newChannel(conn, ch)
+					return
+				}
 			}
 
 			select {
-			case result <- &channel:
+			case <-time.After(channelRetryInterval):
+
+			case <-timeout:
+				errs <- fmt.Errorf("channel creation timeout: %s", err)
 				return
 
-			case errs <- err:
+			case <-ctx.Done():
+				errs <- ctx.Err()
 				return
 
-			case <-time.After(time.Duration(timeoutMillis) * time.Millisecond):
-				err := errors.New("channel creation timeout")
-				errs <- err
+			case <-r.done:
+				errs <- errors.New("handler shut down")
 				return
 			}
 		}
@@ -0,0 +1,32 @@
+package rabbitmq
+
+import (
+	"context"
+
+	"github.com/streadway/amqp"
+)
+
+// contextKey is used to store values in handler contexts
+// without colliding with keys defined in other packages.
+type contextKey string
+
+const (
+	deliveryCtxKey contextKey = "delivery"
+	handleCtxKey   contextKey = "handle"
+)
+
+// String is human readable representation of a context key.
+func (c contextKey) String() string {
+	return "rabbitmq-" + string(c)
+}
+
+// DeliveryFromContext returns the AMQP delivery
+// being handled in a listener handler context.
+func DeliveryFromContext(ctx context.Context) (amqp.Delivery, bool) {
+	d, ok := ctx.Value(deliveryCtxKey).(amqp.Delivery)
+	return d, ok
+}
+
+func withDelivery(ctx context.Context, d amqp.Delivery) context.Context {
+	return context.WithValue(ctx, deliveryCtxKey, d)
+}
@@ -0,0 +1,101 @@
+package rabbitmq
+
+import (
+	"context"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	deadLetterExchangeArg   = "x-dead-letter-exchange"
+	deadLetterRoutingKeyArg = "x-dead-letter-routing-key"
+	deathHeader             = "x-death"
+)
+
+// SetDeadLetter makes messages rejected by the listener
+// to be routed to exchange using routingKey.
+// If routingKey is empty original message routing key is kept.
+// It must be set before listening, queue is declared with
+// the corresponding x-dead-letter-* arguments added to those
+// of the queue registered in the handler, if any. Note that
+// RabbitMQ refuses to declare an existing queue using
+// different arguments, so a queue already declared without
+// them, i.e. by an emitter, must be deleted first.
+func (l *Listener) SetDeadLetter(exchange, routingKey string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.deadLetterExchange = exchange
+	l.deadLetterRoutingKey = routingKey
+}
+
+// queueArgs returns the arguments listener adds
+// to the declaration of its queue.
+// Listener mutex must be held by the caller.
+func (l *Listener) queueArgs() amqp.Table {
+	if l.deadLetterExchange == "" {
+		return nil
+	}
+
+	args := amqp.Table{deadLetterExchangeArg: l.deadLetterExchange}
+	if l.deadLetterRoutingKey != "" {
+		args[deadLetterRoutingKeyArg] = l.deadLetterRoutingKey
+	}
+
+	return args
+}
+
+// Death is an entry of the dead lettering history
+// RabbitMQ keeps in the x-death header.
+type Death struct {
+	Count       int64
+	Reason      string
+	Queue       string
+	Exchange    string
+	RoutingKeys []string
+	Time        time.Time
+}
+
+// Deaths parses the x-death header into a typed history,
+// most recent first.
+func Deaths(headers amqp.Table) []Death {
+	entries, _ := headers[deathHeader].([]interface{})
+
+	deaths := make([]Death, 0, len(entries))
+	for _, e := range entries {
+		t, ok := e.(amqp.Table)
+		if !ok {
+			continue
+		}
+
+		d := Death{}
+		d.Count, _ = t["count"].(int64)
+		d.Reason, _ = t["reason"].(string)
+		d.Queue, _ = t["queue"].(string)
+		d.Exchange, _ = t["exchange"].(string)
+		d.Time, _ = t["time"].(time.Time)
+
+		keys, _ := t["routing-keys"].([]interface{})
+		for _, k := range keys {
+			if s, ok := k.(string); ok {
+				d.RoutingKeys = append(d.RoutingKeys, s)
+			}
+		}
+
+		deaths = append(deaths, d)
+	}
+
+	return deaths
+}
+
+// DeathHistory returns the dead lettering history
+// of the message being handled in ctx.
+func DeathHistory(ctx context.Context) []Death {
+	d, ok := DeliveryFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	return Deaths(d.Headers)
+}
@@ -0,0 +1,82 @@
+package rabbitmq
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestDeaths(t *testing.T) {
+	now := time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    []Death
+	}{
+		{
+			name:    "no header",
+			headers: amqp.Table{},
+			want:    []Death{},
+		},
+		{
+			name:    "invalid header",
+			headers: amqp.Table{"x-death": "rejected"},
+			want:    []Death{},
+		},
+		{
+			name: "history",
+			headers: amqp.Table{
+				"x-death": []interface{}{
+					amqp.Table{
+						"count":        int64(2),
+						"reason":       "expired",
+						"queue":        "orders.retry.1000ms",
+						"exchange":     "",
+						"time":         now,
+						"routing-keys": []interface{}{"orders.retry.1000ms"},
+					},
+					amqp.Table{
+						"count":        int64(1),
+						"reason":       "rejected",
+						"queue":        "orders",
+						"exchange":     "events",
+						"time":         now.Add(-time.Minute),
+						"routing-keys": []interface{}{"orders", "audit"},
+					},
+				},
+			},
+			want: []Death{
+				{Count: 2, Reason: "expired", Queue: "orders.retry.1000ms", Time: now, RoutingKeys: []string{"orders.retry.1000ms"}},
+				{Count: 1, Reason: "rejected", Queue: "orders", Exchange: "events", Time: now.Add(-time.Minute), RoutingKeys: []string{"orders", "audit"}},
+			},
+		},
+		{
+			name: "skips invalid entries and fields",
+			headers: amqp.Table{
+				"x-death": []interface{}{
+					"invalid",
+					amqp.Table{
+						"count":        "1",
+						"reason":       "maxlen",
+						"routing-keys": []interface{}{int64(1), "orders"},
+					},
+				},
+			},
+			want: []Death{
+				{Reason: "maxlen", RoutingKeys: []string{"orders"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Deaths(tt.headers)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Deaths() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// VHost returns the virtual host the handler connects to
+// and the one used in definitions.
+func (cfg *Config) VHost() string {
+	return cfg.ValAsString("rabbitmq.vhost", "/")
+}
+
+// ExportDefinitions returns handler registered exchanges, queues and bindings
+// using RabbitMQ definitions.json schema.
+func (r *RabbitMQ) ExportDefinitions() *Definitions {
+	vhost := r.cfg.VHost()
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	d := &Definitions{
+		Exchanges: []ExchangeDefinition{},
+		Queues:    []QueueDefinition{},
+		Bindings:  []BindingDefinition{},
+	}
+
+	for _, e := range r.Exchanges {
+		d.Exchanges = append(d.Exchanges, ExchangeDefinition{
+			Name:       e.Name,
+			VHost:      vhost,
+			Type:       e.Kind,
+			Durable:    e.Durable,
+			AutoDelete: e.AutoDelete,
+			Internal:   e.Internal,
+			Arguments:  arguments(e.ArgsTable),
+		})
+	}
+
+	for _, q := range r.Queues {
+		d.Queues = append(d.Queues, QueueDefinition{
+			Name:       q.Name,
+			VHost:      vhost,
+			Durable:    q.Durable,
+			AutoDelete: q.AutoDelete,
+			Arguments:  arguments(q.ArgsTable),
+		})
+	}
+
+	for _, b := range r.Bindings {
+		d.Bindings = append(d.Bindings, BindingDefinition{
+			Source:          b.Exchange.Name,
+			VHost:           vhost,
+			Destination:     b.Queue.Name,
+			DestinationType: "queue",
+			RoutingKey:      b.RoutingKey,
+			Arguments:       arguments(b.ArgsTable),
+		})
+	}
+
+	sort.Slice(d.Exchanges, func(i, j int) bool { return d.Exchanges[i].Name < d.Exchanges[j].Name })
+	sort.Slice(d.Queues, func(i, j int) bool { return d.Queues[i].Name < d.Queues[j].Name })
+	sort.Slice(d.Bindings, func(i, j int) bool {
+		bi, bj := d.Bindings[i], d.Bindings[j]
+		if bi.Source != bj.Source {
+			return bi.Source < bj.Source
+		}
+		if bi.Destination != bj.Destination {
+			return bi.Destination < bj.Destination
+		}
+		return bi.RoutingKey < bj.RoutingKey
+	})
+
+	return d
+}
+
+// WriteDefinitions writes handler registered topology to w
+// as a RabbitMQ definitions.json document.
+func (r *RabbitMQ) WriteDefinitions(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.ExportDefinitions())
+}
+
+// LoadDefinitions reads a RabbitMQ definitions.json file
+// and declares its exchanges, queues and bindings
+// that belong to the configured virtual host.
+func (r *RabbitMQ) LoadDefinitions(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	d, err := ReadDefinitions(f)
+	if err != nil {
+		return err
+	}
+
+	return r.Declare(d.Topology(r.cfg.VHost()))
+}
+
+// ReadDefinitions decodes a RabbitMQ definitions.json document.
+// Sections other than exchanges, queues and bindings are ignored.
+func ReadDefinitions(rd io.Reader) (*Definitions, error) {
+	d := &Definitions{}
+	err := json.NewDecoder(rd).Decode(d)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Topology returns the exchanges, queues and bindings in definitions
+// that belong to vhost. Entries without virtual host are included.
+// Bindings whose destination is an exchange are not supported and are skipped.
+func (d *Definitions) Topology(vhost string) *Topology {
+	t := &Topology{}
+
+	for _, e := range d.Exchanges {
+		if !inVHost(e.VHost, vhost) {
+			continue
+		}
+
+		t.Exchanges = append(t.Exchanges, &Exchange{
+			ID:         uuid.New(),
+			Name:       e.Name,
+			Kind:       e.Type,
+			Durable:    e.Durable,
+			AutoDelete: e.AutoDelete,
+			Internal:   e.Internal,
+			ArgsTable:  table(e.Arguments),
+		})
+	}
+
+	for _, q := range d.Queues {
+		if !inVHost(q.VHost, vhost) {
+			continue
+		}
+
+		t.Queues = append(t.Queues, &Queue{
+			ID:         uuid.New().String(),
+			Name:       q.Name,
+			Durable:    q.Durable,
+			AutoDelete: q.AutoDelete,
+			ArgsTable:  table(q.Arguments),
+		})
+	}
+
+	for _, b := range d.Bindings {
+		if b.DestinationType != "" && b.DestinationType != "queue" {
+			continue
+		}
+
+		if !inVHost(b.VHost, vhost) {
+			continue
+		}
+
+		t.Bindings = append(t.Bindings, &Binding{
+			ID:         uuid.New().String(),
+			Name:       bindingName(b.Source, b.Destination, b.RoutingKey),
+			Exchange:   t.exchange(b.Source),
+			Queue:      t.queue(b.Destination),
+			RoutingKey: b.RoutingKey,
+			ArgsTable:  table(b.Arguments),
+		})
+	}
+
+	return t
+}
+
+// inVHost returns true if an entry virtual host is vhost
+// or it has none.
+func inVHost(entry, vhost string) bool {
+	return entry == "" || entry == vhost
+}
+
+// arguments returns a non nil arguments map
+// as expected by definitions.json.
+func arguments(table map[string]interface{}) map[string]interface{} {
+	if table == nil {
+		return map[string]interface{}{}
+	}
+
+	return table
+}
+
+// table returns an AMQP arguments table from definitions arguments.
+// JSON numbers without fractional part are converted to integers
+// because RabbitMQ expects them for arguments like x-message-ttl.
+func table(args map[string]interface{}) map[string]interface{} {
+	if len(args) == 0 {
+		return nil
+	}
+
+	t := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		if f, ok := v.(float64); ok && f == math.Trunc(f) {
+			v = int64(f)
+		}
+		t[k] = v
+	}
+
+	return t
+}
+
+// bindingName returns the name used to register a binding.
+func bindingName(exchange, queue, routingKey string) string {
+	return exchange + ":" + queue + ":" + routingKey
+}
@@ -0,0 +1,142 @@
+package rabbitmq
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+func TestTable(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want map[string]interface{}
+	}{
+		{"nil", nil, nil},
+		{"empty", map[string]interface{}{}, nil},
+		{
+			name: "integers",
+			args: map[string]interface{}{"x-message-ttl": float64(60000), "x-max-length": float64(-1)},
+			want: map[string]interface{}{"x-message-ttl": int64(60000), "x-max-length": int64(-1)},
+		},
+		{
+			name: "other values",
+			args: map[string]interface{}{"x-ratio": 0.5, "x-queue-mode": "lazy", "x-single-active-consumer": true},
+			want: map[string]interface{}{"x-ratio": 0.5, "x-queue-mode": "lazy", "x-single-active-consumer": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := table(tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("table() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+const definitions = `{
+  "rabbit_version": "3.7.14",
+  "exchanges": [
+    {"name": "events", "vhost": "/", "type": "topic", "durable": true, "auto_delete": false, "internal": false, "arguments": {}},
+    {"name": "billing", "vhost": "billing", "type": "direct", "durable": true, "auto_delete": false, "internal": false, "arguments": {}}
+  ],
+  "queues": [
+    {"name": "orders", "vhost": "/", "durable": true, "auto_delete": false, "arguments": {"x-message-ttl": 60000, "x-queue-mode": "lazy"}},
+    {"name": "audit", "durable": false, "auto_delete": true, "arguments": {}},
+    {"name": "invoices", "vhost": "billing", "durable": true, "auto_delete": false, "arguments": {}}
+  ],
+  "bindings": [
+    {"source": "events", "vhost": "/", "destination": "orders", "destination_type": "queue", "routing_key": "order.*", "arguments": {}},
+    {"source": "events", "vhost": "/", "destination": "billing", "destination_type": "exchange", "routing_key": "#", "arguments": {}},
+    {"source": "billing", "vhost": "billing", "destination": "invoices", "destination_type": "queue", "routing_key": "", "arguments": {}}
+  ]
+}`
+
+func TestDefinitionsTopology(t *testing.T) {
+	d, err := ReadDefinitions(strings.NewReader(definitions))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	top := d.Topology("/")
+
+	if len(top.Exchanges) != 1 || top.Exchanges[0].Name != "events" || top.Exchanges[0].ArgsTable != nil {
+		t.Errorf("exchanges = %+v, want events", top.Exchanges)
+	}
+
+	if len(top.Queues) != 2 {
+		t.Fatalf("queues = %+v, want orders and audit", top.Queues)
+	}
+
+	orders := top.Queues[0]
+	wantArgs := map[string]interface{}{"x-message-ttl": int64(60000), "x-queue-mode": "lazy"}
+	if orders.Name != "orders" || !reflect.DeepEqual(orders.ArgsTable, wantArgs) {
+		t.Errorf("orders queue = %+v", orders)
+	}
+
+	if audit := top.Queues[1]; audit.Name != "audit" || audit.Durable || !audit.AutoDelete {
+		t.Errorf("audit queue = %+v", audit)
+	}
+
+	if len(top.Bindings) != 1 {
+		t.Fatalf("bindings = %+v, want events to orders", top.Bindings)
+	}
+
+	b := top.Bindings[0]
+	if b.Exchange != top.Exchanges[0] || b.Queue != orders || b.RoutingKey != "order.*" {
+		t.Errorf("binding = %+v", b)
+	}
+
+	billing := d.Topology("billing")
+	if len(billing.Exchanges) != 1 || len(billing.Queues) != 2 || len(billing.Bindings) != 1 {
+		t.Errorf("billing topology = %+v", billing)
+	}
+}
+
+func TestURLVHost(t *testing.T) {
+	d, err := ReadDefinitions(strings.NewReader(definitions))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		vhost     string
+		exchanges []string
+	}{
+		{"default", "", []string{"events"}},
+		{"root", "/", []string{"events"}},
+		{"named", "billing", []string{"billing"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testCfg{}
+			if tt.vhost != "" {
+				c["rabbitmq.vhost"] = tt.vhost
+			}
+			cfg := &Config{Cfg: c}
+
+			uri, err := amqp.ParseURI(cfg.URL())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if uri.Vhost != cfg.VHost() {
+				t.Errorf("URL() vhost = %q, want %q", uri.Vhost, cfg.VHost())
+			}
+
+			var names []string
+			for _, e := range d.Topology(uri.Vhost).Exchanges {
+				names = append(names, e.Name)
+			}
+
+			if !reflect.DeepEqual(names, tt.exchanges) {
+				t.Errorf("Topology(%q) exchanges = %v, want %v", uri.Vhost, names, tt.exchanges)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+	"gitlab.com/mikrowezel/backend/broker"
+	"gitlab.com/mikrowezel/backend/broker/metrics"
+)
+
+// Emit publishes a message to the emitter exchange
+// and waits until the broker has received it.
+// In confirm mode it waits until the broker confirms it.
+func (e *Emitter) Emit(msg broker.BaseMessage, routingKey string) error {
+	return e.EmitContext(context.Background(), msg, routingKey)
+}
+
+// EmitContext publishes a message to the emitter exchange
+// and waits until the broker has received it or ctx is done.
+func (e *Emitter) EmitContext(ctx context.Context, msg broker.BaseMessage, routingKey string) error {
+	select {
+	case err := <-e.EmitAsyncContext(ctx, msg, routingKey):
+		return err
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// EmitAsync queues a message for publishing to the emitter exchange.
+// Returned channel receives the outcome of the publication,
+// in confirm mode it does once the broker confirms it.
+func (e *Emitter) EmitAsync(msg broker.BaseMessage, routingKey string) <-chan error {
+	return e.EmitAsyncContext(context.Background(), msg, routingKey)
+}
+
+// EmitAsyncContext queues a message for publishing to the emitter exchange.
+// If ctx is done before the message is queued or published it is
+// discarded and its outcome is the ctx error.
+// A publish span, child of the one in ctx if any, is started
+// and its trace context propagated through message headers.
+func (e *Emitter) EmitAsyncContext(ctx context.Context, msg broker.BaseMessage, routingKey string) <-chan error {
+	ctx, span := e.startSpan(ctx, msg, routingKey)
+
+	ebm := &EmittedBaseMessage{
+		emitter:    e,
+		ctx:        ctx,
+		event:      msg,
+		routingKey: routingKey,
+		span:       span,
+		errorChan:  make(chan error, 1),
+	}
+
+	e.eventsMutex.RLock()
+	defer e.eventsMutex.RUnlock()
+
+	if e.closed {
+		ebm.resolve(ErrEmitterClosed)
+		return ebm.errorChan
+	}
+
+	// Events buffer may be full, do not keep
+	// a closing emitter waiting for it.
+	select {
+	case e.events <- ebm:
+
+	case <-e.closing:
+		ebm.resolve(ErrEmitterClosed)
+
+	case <-ctx.Done():
+		ebm.resolve(ctx.Err())
+	}
+
+	return ebm.errorChan
+}
+
+// run publishes queued messages.
+// There is only one publisher goroutine per emitter
+// because AMQP channels are not safe for concurrent publishing.
+func (e *Emitter) run() {
+	defer close(e.stopped)
+
+	for ebm := range e.events {
+		if err := ebm.ctx.Err(); err != nil {
+			ebm.resolve(err)
+			continue
+		}
+
+		err := e.publish(ebm)
+		if err != nil || !ebm.pending {
+			ebm.resolve(err)
+		}
+	}
+}
+
+// publish sends a message to the broker.
+// If the channel is lost it tries once more using a new one,
+// waiting for the emitter to be resumed if connection was lost too.
+func (e *Emitter) publish(ebm *EmittedBaseMessage) error {
+	p, err := publishing(ebm.event)
+	if err != nil {
+		return err
+	}
+
+	if e.IsMandatory() {
+		ensureMessageID(&p)
+	}
+	ebm.messageID = p.MessageId
+
+	e.inject(ebm, &p)
+
+	err = e.send(ebm, p)
+	if err == nil {
+		return nil
+	}
+
+	if e.isConnected() {
+		err = e.send(ebm, p)
+	} else {
+		select {
+		case <-e.resumed:
+			err = e.send(ebm, p)
+
+		case <-time.After(resumeInterval):
+
+		case <-ebm.ctx.Done():
+			err = ebm.ctx.Err()
+		}
+	}
+
+	if err != nil {
+		e.log.Error(err, "Cannot publish message", "exchange", e.exchange, "type", ebm.event.TypeID(), "message-id", ebm.messageID)
+	}
+
+	return err
+}
+
+func (e *Emitter) send(ebm *EmittedBaseMessage, p amqp.Publishing) error {
+	ch, tracker, mandatory, err := e.getChannel()
+	if err != nil {
+		return err
+	}
+
+	var tag uint64
+	if tracker != nil {
+		tag = tracker.add(ebm)
+	}
+
+	err = ch.Publish(e.exchange, ebm.routingKey, mandatory, false, p)
+	if err != nil {
+		if tracker != nil {
+			tracker.discard(tag)
+		}
+		e.resetChannel()
+		return err
+	}
+
+	ebm.pending = tracker != nil
+	return nil
+}
+
+// getChannel returns emitter channel opening a new one if needed.
+// In confirm mode it also returns the tracker for channel confirmations.
+func (e *Emitter) getChannel() (*amqp.Channel, *confirmTracker, bool, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.channel != nil {
+		return e.channel, e.tracker, e.mandatory, nil
+	}
+
+	ch, err := e.connection.Channel()
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("cannot open emitter channel: %s", err)
+	}
+
+	e.tracker = nil
+
+	var returns chan amqp.Return
+	if e.mandatory {
+		// Buffered so that the connection reader is not blocked
+		// while returns are being processed.
+		returns = ch.NotifyReturn(make(chan amqp.Return, cap(e.events)))
+	}
+
+	if e.confirmTimeout > 0 {
+		err = ch.Confirm(false)
+		if err != nil {
+			ch.Close()
+			return nil, nil, false, fmt.Errorf("cannot put emitter channel in confirm mode: %s", err)
+		}
+
+		e.tracker = newConfirmTracker(e.confirmTimeout)
+		confirms := ch.NotifyPublish(make(chan amqp.Confirmation, cap(e.events)))
+		go e.tracker.listen(confirms, returns, e.returned)
+
+	} else if returns != nil {
+		go e.listenReturns(returns)
+	}
+
+	e.channel = ch
+	return ch, e.tracker, e.mandatory, nil
+}
+
+// resetChannel discards emitter channel.
+// It is closed without holding the emitter mutex because closing
+// waits for the connection reader, which may be delivering
+// a return to a goroutine that needs it.
+func (e *Emitter) resetChannel() {
+	e.mutex.Lock()
+	ch := e.channel
+	e.channel = nil
+	e.mutex.Unlock()
+
+	if ch != nil {
+		ch.Close()
+	}
+}
+
+func (e *Emitter) isConnected() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return !e.connection.IsClosed()
+}
+
+// record updates emitter metrics with the outcome of an emission.
+func (e *Emitter) record(ebm *EmittedBaseMessage, err error) {
+	e.hooksMutex.RLock()
+	m := e.metrics
+	e.hooksMutex.RUnlock()
+
+	switch err {
+	case nil:
+		m.MessageEmitted(e.exchange, ebm.event.TypeID())
+
+	case ErrNacked:
+		m.ConfirmNacked(e.exchange)
+		m.EmitFailed(e.exchange, ebm.event.TypeID())
+
+	default:
+		m.EmitFailed(e.exchange, ebm.event.TypeID())
+	}
+}
+
+func (e *Emitter) setMetrics(m metrics.Metrics) {
+	e.hooksMutex.Lock()
+	defer e.hooksMutex.Unlock()
+
+	e.metrics = m
+}
+
+// resume makes the emitter use a new connection.
+func (e *Emitter) resume(conn *amqp.Connection) {
+	e.resetChannel()
+
+	e.mutex.Lock()
+	e.connection = conn
+	e.mutex.Unlock()
+
+	select {
+	case e.resumed <- struct{}{}:
+	default:
+	}
+}
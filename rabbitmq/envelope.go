@@ -0,0 +1,109 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/streadway/amqp"
+	"gitlab.com/mikrowezel/backend/broker"
+)
+
+// CausationIDHeader is the header used to carry
+// broker.Message causation id.
+const CausationIDHeader = "causation-id"
+
+// publishing builds an AMQP publishing for a message.
+// broker.Message envelope fields are mapped to their
+// equivalent AMQP properties.
+func publishing(msg broker.BaseMessage) (amqp.Publishing, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return amqp.Publishing{}, fmt.Errorf("message %s cannot be marshalled: %s", msg.TypeID(), err)
+	}
+
+	p := amqp.Publishing{
+		ContentType: "application/json",
+		Type:        msg.TypeID(),
+		Body:        body,
+	}
+
+	m, ok := msg.(*broker.Message)
+	if !ok {
+		return p, nil
+	}
+
+	p.MessageId = m.ID
+	p.Timestamp = m.CreatedAt
+	p.CorrelationId = m.CorrelationID
+
+	p.Headers = amqp.Table{}
+	for k, v := range m.Headers {
+		if !isTransportHeader(k) {
+			p.Headers[k] = v
+		}
+	}
+
+	if m.CausationID != "" {
+		p.Headers[CausationIDHeader] = m.CausationID
+	}
+
+	return p, nil
+}
+
+// fillEnvelope completes broker.Message envelope fields
+// not present in the body using delivery AMQP properties.
+func fillEnvelope(msg broker.BaseMessage, d amqp.Delivery) {
+	m, ok := msg.(*broker.Message)
+	if !ok {
+		return
+	}
+
+	if m.ID == "" {
+		m.ID = d.MessageId
+	}
+
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = d.Timestamp
+	}
+
+	if m.CorrelationID == "" {
+		m.CorrelationID = d.CorrelationId
+	}
+
+	if m.CausationID == "" {
+		m.CausationID, _ = d.Headers[CausationIDHeader].(string)
+	}
+
+	for k, v := range d.Headers {
+		s, ok := v.(string)
+		if !ok || isTransportHeader(k) {
+			continue
+		}
+
+		if m.Headers == nil {
+			m.Headers = make(map[string]string)
+		}
+
+		if _, ok := m.Headers[k]; !ok {
+			m.Headers[k] = s
+		}
+	}
+}
+
+// isTransportHeader returns true if a header is set by the broker
+// client when publishing and so it is not part of the message
+// envelope, i.e. trace context headers.
+func isTransportHeader(key string) bool {
+	switch key {
+	case CausationIDHeader, TypeIDHeader, RetryAttemptHeader:
+		return true
+	}
+
+	for _, f := range propagator.Fields() {
+		if key == f {
+			return true
+		}
+	}
+
+	return false
+}
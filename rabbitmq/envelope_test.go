@@ -0,0 +1,43 @@
+package rabbitmq
+
+import (
+	"testing"
+
+	"github.com/streadway/amqp"
+	"gitlab.com/mikrowezel/backend/broker"
+)
+
+func TestFillEnvelopeSkipsTransportHeaders(t *testing.T) {
+	m := &broker.Message{}
+	d := amqp.Delivery{
+		Headers: amqp.Table{
+			"traceparent":      "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+			"tracestate":       "vendor=value",
+			TypeIDHeader:       "order.created",
+			CausationIDHeader:  "cause-1",
+			RetryAttemptHeader: int64(2),
+			"tenant":           "acme",
+		},
+	}
+
+	fillEnvelope(m, d)
+
+	if len(m.Headers) != 1 || m.Headers["tenant"] != "acme" {
+		t.Errorf("headers = %v, want only tenant", m.Headers)
+	}
+
+	if m.CausationID != "cause-1" {
+		t.Errorf("causation id = %s, want cause-1", m.CausationID)
+	}
+
+	m.Headers["traceparent"] = "stale"
+
+	p, err := publishing(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := p.Headers["traceparent"]; ok {
+		t.Error("publishing carries a stale traceparent")
+	}
+}
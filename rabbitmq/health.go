@@ -0,0 +1,139 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// Alive returns true while the handler has not been shut down
+// and it is either connected or trying to reconnect.
+func (r *RabbitMQ) Alive() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.alive && !r.closed
+}
+
+// Ready returns true if the handler is connected, its topology
+// is declared, its channel pool can open channels and all
+// started listeners are consuming.
+func (r *RabbitMQ) Ready() bool {
+	return r.Status().Ready
+}
+
+// Status returns a report of the handler state.
+func (r *RabbitMQ) Status() Status {
+	r.mutex.RLock()
+	s := Status{
+		Name:      r.name,
+		Alive:     r.alive && !r.closed,
+		Connected: r.conn != nil && !r.conn.IsClosed(),
+		Topology:  r.ready,
+		Listeners: make([]ListenerStatus, 0, len(r.Listeners)),
+		Emitters:  make([]EmitterStatus, 0, len(r.Emitters)),
+	}
+
+	for name, l := range r.Listeners {
+		s.Listeners = append(s.Listeners, l.status(name))
+	}
+
+	for name, e := range r.Emitters {
+		s.Emitters = append(s.Emitters, e.status(name))
+	}
+
+	if r.Channels != nil {
+		s.Channels = ChannelsStatus{
+			Open:  r.Channels.IsOpen(),
+			Size:  r.Channels.Size(),
+			InUse: r.Channels.InUse(),
+		}
+	}
+	r.mutex.RUnlock()
+
+	sort.Slice(s.Listeners, func(i, j int) bool { return s.Listeners[i].Name < s.Listeners[j].Name })
+	sort.Slice(s.Emitters, func(i, j int) bool { return s.Emitters[i].Name < s.Emitters[j].Name })
+
+	s.Ready = s.Alive && s.Connected && s.Topology && s.Channels.Open
+	for _, l := range s.Listeners {
+		if l.Started && !l.Consuming {
+			s.Ready = false
+		}
+	}
+
+	return s
+}
+
+// LivenessHandler returns an http.Handler that serves handler status
+// as JSON, responding 503 Service Unavailable if it is not alive.
+func (r *RabbitMQ) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s := r.Status()
+		writeStatus(w, s, s.Alive)
+	})
+}
+
+// ReadinessHandler returns an http.Handler that serves handler status
+// as JSON, responding 503 Service Unavailable if it is not ready.
+func (r *RabbitMQ) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s := r.Status()
+		writeStatus(w, s, s.Ready)
+	})
+}
+
+func writeStatus(w http.ResponseWriter, s Status, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(s)
+}
+
+func (r *RabbitMQ) setReady(ready bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.ready = ready
+}
+
+func (l *Listener) status(name string) ListenerStatus {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	started := l.done != nil
+	return ListenerStatus{
+		Name:      name,
+		Exchange:  l.exchange,
+		Queue:     l.queue,
+		Started:   started,
+		Consumers: l.active,
+		Consuming: started && l.active == len(l.consumers),
+	}
+}
+
+// setActive updates the number of consumers receiving deliveries.
+func (l *Listener) setActive(delta int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.active += delta
+}
+
+func (e *Emitter) status(name string) EmitterStatus {
+	e.eventsMutex.RLock()
+	closed := e.closed
+	e.eventsMutex.RUnlock()
+
+	return EmitterStatus{
+		Name:     name,
+		Exchange: e.exchange,
+		Closed:   closed,
+		Queued:   len(e.events),
+		Pending:  e.waiting(),
+	}
+}
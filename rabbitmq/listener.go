@@ -0,0 +1,555 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+	"gitlab.com/mikrowezel/backend/broker"
+	"gitlab.com/mikrowezel/backend/broker/mapper"
+	"gitlab.com/mikrowezel/backend/broker/metrics"
+)
+
+// TypeIDHeader is the header used to get message type id
+// when delivery Type property is not set.
+const TypeIDHeader = "type-id"
+
+// resumeInterval is the time a listener waits
+// between consuming retries after losing its channel.
+const resumeInterval = 5 * time.Second
+
+// Handle registers the handler for messages of a type id.
+// It can be called while the listener is consuming.
+func (l *Listener) Handle(typeID string, h broker.Handler) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if h == nil {
+		delete(l.handlers, typeID)
+		return
+	}
+
+	l.handlers[typeID] = h
+}
+
+// HandleDefault registers the handler for messages
+// whose type id has no registered handler.
+func (l *Listener) HandleDefault(h broker.Handler) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.fallback = h
+}
+
+// Listen declares listener queue, binds it to listener exchange
+// using the queue name as routing key and starts passing
+// received messages to their registered handlers.
+// If h is not nil it is registered as the default handler.
+// Listener stops when the handler context is done.
+func (l *Listener) Listen(h broker.Handler) error {
+	return l.ListenContext(l.ctx, h)
+}
+
+// ListenContext is like Listen but handlers receive
+// contexts derived from ctx and listener stops when it is done.
+func (l *Listener) ListenContext(ctx context.Context, h broker.Handler) error {
+	if h != nil {
+		l.HandleDefault(h)
+	}
+
+	if !l.hasHandlers() {
+		return errors.New("no message handler provided")
+	}
+
+	queues, err := l.declarations()
+	if err != nil {
+		return err
+	}
+
+	err = l.start(ctx, queues)
+	if err != nil {
+		return err
+	}
+
+	if l.owner != nil {
+		l.owner.registerQueues(queues)
+	}
+
+	return nil
+}
+
+// start declares listener queues and starts its consumers.
+func (l *Listener) start(ctx context.Context, queues []*Queue) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.done != nil {
+		return errors.New("listener already started")
+	}
+
+	n := l.concurrency
+	if n < 1 {
+		n = 1
+	}
+
+	l.declared = queues
+	l.consumers = make([]*consumer, n)
+	deliveries := make([]<-chan amqp.Delivery, n)
+
+	for i := range l.consumers {
+		ds, err := l.setup(i)
+		if err != nil {
+			l.closeConsumers()
+			return err
+		}
+
+		deliveries[i] = ds
+	}
+
+	l.handlerCtx = ctx
+	l.stopped = make(chan struct{})
+	l.done = make(chan struct{})
+
+	l.wg.Add(n)
+	for i := range l.consumers {
+		go l.consume(i, deliveries[i])
+	}
+
+	go func(done chan struct{}) {
+		l.wg.Wait()
+		close(done)
+	}(l.done)
+
+	go l.watch(ctx, l.stopped)
+
+	return nil
+}
+
+// watch stops the listener when ctx is done.
+func (l *Listener) watch(ctx context.Context, stopped chan struct{}) {
+	select {
+	case <-ctx.Done():
+		err := l.Stop()
+		if err != nil {
+			l.log.Error(err, "Cannot stop listener", "queue", l.queue)
+		}
+
+	case <-stopped:
+	}
+}
+
+// SetMapper sets the mapper used to decode received messages.
+// It can be called while the listener is consuming, a
+// mapper.DynamicMapper allows registering types meanwhile.
+func (l *Listener) SetMapper(m mapper.BaseMessageMapper) {
+	if m == nil {
+		m = mapper.NewMessageMapper()
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.mapper = m
+}
+
+// SetConcurrency sets the number of consumers, each one
+// on its own channel, the listener starts.
+// It must be set before listening.
+func (l *Listener) SetConcurrency(n int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.concurrency = n
+}
+
+// SetPrefetch sets the QoS prefetch count and size
+// applied to each listener consumer channel.
+// It must be set before listening.
+func (l *Listener) SetPrefetch(count, size int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.prefetchCount = count
+	l.prefetchSize = size
+}
+
+// Stop cancels listener consumers and waits
+// for the messages in process, if any, to be handled.
+func (l *Listener) Stop() error {
+	return l.stop(context.Background())
+}
+
+// stop cancels listener consumers and waits for the messages
+// in process to be handled or ctx to be done.
+func (l *Listener) stop(ctx context.Context) error {
+	l.mutex.Lock()
+	if l.done == nil {
+		l.mutex.Unlock()
+		return nil
+	}
+
+	consumers := make([]*consumer, len(l.consumers))
+	copy(consumers, l.consumers)
+	done := l.done
+	select {
+	case <-l.stopped:
+	default:
+		close(l.stopped)
+	}
+	l.mutex.Unlock()
+
+	var err error
+	for _, c := range consumers {
+		if c == nil {
+			continue
+		}
+
+		cerr := c.channel.Cancel(c.tag, false)
+		if cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	select {
+	case <-done:
+
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.closeRetryPublisher()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.closeConsumers()
+	l.done = nil
+	return err
+}
+
+// setup opens a consumer channel, declares and binds listener queue
+// and starts consuming from it.
+// If listener queue has no name the one assigned by the server
+// on the first declaration is used from then on.
+// Listener mutex must be held by the caller.
+func (l *Listener) setup(i int) (<-chan amqp.Delivery, error) {
+	ch, err := l.connection.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("cannot open listener channel: %s", err)
+	}
+
+	err = ch.Qos(l.prefetchCount, l.prefetchSize, false)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	var q amqp.Queue
+	for j, dq := range l.declared {
+		aq, err := ch.QueueDeclare(dq.Name, dq.Durable, dq.AutoDelete, dq.Exclusive, dq.NoWait, dq.ArgsTable)
+		if err != nil {
+			ch.Close()
+			return nil, err
+		}
+
+		if j == 0 {
+			// Keep the server assigned name so that the other
+			// consumers and later setups share the same queue.
+			if dq.Name == "" {
+				dq.Name = aq.Name
+			}
+
+			q = aq
+		}
+	}
+
+	if l.exchange != "" {
+		err = ch.QueueBind(q.Name, q.Name, l.exchange, false, nil)
+		if err != nil {
+			ch.Close()
+			return nil, err
+		}
+	}
+
+	tag := uuid.New().String()
+	deliveries, err := ch.Consume(q.Name, tag, l.ackMode == AckAuto, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	l.consumers[i] = &consumer{
+		channel: ch,
+		tag:     tag,
+	}
+
+	return deliveries, nil
+}
+
+// declarations returns the queues the listener declares:
+// its own queue followed by retry and parking queues, if any.
+// Listener queue is based on the one registered in the handler
+// with the same name, if any, so that both declarations match.
+// Listener arguments are added to the registered ones.
+func (l *Listener) declarations() ([]*Queue, error) {
+	var base *Queue
+	if l.owner != nil && l.queue != "" {
+		base = l.owner.queue(l.queue)
+	}
+
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	q := &Queue{
+		ID:      uuid.New().String(),
+		Name:    l.queue,
+		Durable: true,
+	}
+
+	args := amqp.Table{}
+
+	if base != nil {
+		q.ID = base.ID
+		q.Durable = base.Durable
+		q.AutoDelete = base.AutoDelete
+		q.Exclusive = base.Exclusive
+		q.NoWait = base.NoWait
+
+		for k, v := range base.ArgsTable {
+			args[k] = v
+		}
+	}
+
+	for k, v := range l.queueArgs() {
+		args[k] = v
+	}
+
+	if len(args) > 0 {
+		q.ArgsTable = args
+	}
+
+	retries, err := l.retryQueues()
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]*Queue{q}, retries...), nil
+}
+
+// closeConsumers closes consumer channels.
+// Listener mutex must be held by the caller.
+func (l *Listener) closeConsumers() {
+	for i, c := range l.consumers {
+		if c != nil {
+			c.channel.Close()
+			l.consumers[i] = nil
+		}
+	}
+}
+
+// consume dispatches deliveries of a consumer until listener is stopped.
+// Messages are acknowledged on the channel they were received from.
+// If the channel is lost it waits for the listener to be resumed
+// and starts consuming again.
+func (l *Listener) consume(i int, deliveries <-chan amqp.Delivery) {
+	defer l.wg.Done()
+
+	for {
+		l.setActive(1)
+
+		for open := true; open; {
+			select {
+			case d, ok := <-deliveries:
+				if !ok {
+					open = false
+					continue
+				}
+				l.dispatch(d)
+
+			case <-l.stopped:
+				l.setActive(-1)
+				l.log.Info("Listener stopped consuming", "queue", l.queue, "consumer", i)
+				return
+			}
+		}
+
+		l.setActive(-1)
+
+		l.log.Info("Listener channel closed", "queue", l.queue, "consumer", i)
+
+		deliveries = l.reconsume(i)
+		if deliveries == nil {
+			return
+		}
+
+		l.log.Info("Listener resumed", "queue", l.queue, "consumer", i)
+	}
+}
+
+// reconsume retries consumer setup until it succeeds
+// or listener is stopped, in which case it returns nil.
+func (l *Listener) reconsume(i int) <-chan amqp.Delivery {
+	for {
+		select {
+		case <-l.stopped:
+			return nil
+
+		case <-l.resumedSignal():
+
+		case <-time.After(resumeInterval):
+		}
+
+		l.mutex.Lock()
+		deliveries, err := l.setup(i)
+		l.mutex.Unlock()
+
+		if err == nil {
+			return deliveries
+		}
+
+		l.log.Error(err, "Cannot resume listener", "queue", l.queue, "consumer", i)
+	}
+}
+
+// resume makes the listener use a new connection.
+func (l *Listener) resume(conn *amqp.Connection) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.connection = conn
+
+	// Wake up all waiting consumers.
+	close(l.resumed)
+	l.resumed = make(chan struct{})
+}
+
+func (l *Listener) resumedSignal() chan struct{} {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	return l.resumed
+}
+
+// dispatch decodes a delivery and passes it to its handler.
+// Messages that cannot be decoded or handled are rejected
+// and then dead-lettered if the listener has a dead-letter exchange.
+// Handled messages are acknowledged according to listener AckMode.
+// Handler context carries a logger with delivery fields.
+func (l *Listener) dispatch(d amqp.Delivery) {
+	tid := typeID(d)
+
+	l.mutex.RLock()
+	mode := l.ackMode
+	mp := l.mapper
+	m := l.metrics
+	l.mutex.RUnlock()
+
+	m.MessageConsumed(l.queue, tid)
+
+	ctx, span := l.startSpan(d, tid)
+	defer span.End()
+
+	ctx, lg := l.withLogger(ctx, d, tid)
+
+	h, err := l.handler(tid)
+	if err != nil {
+		lg.Error(err, "Cannot handle message", "queue", l.queue, "type", tid)
+		spanError(span, err)
+		reject(mode, d)
+		return
+	}
+
+	msg, err := mp.MapMessage(tid, d.Body)
+	if err != nil {
+		lg.Error(err, "Cannot map message", "queue", l.queue, "type", tid)
+		m.DecodeFailed(l.queue, tid)
+		spanError(span, err)
+		reject(mode, d)
+		return
+	}
+
+	fillEnvelope(msg, d)
+
+	ctx = withDelivery(ctx, d)
+
+	var dh *DeliveryHandle
+	if mode == AckManual {
+		dh = &DeliveryHandle{delivery: d}
+		ctx = withHandle(ctx, dh)
+	}
+
+	start := time.Now()
+	err = h(ctx, msg)
+	m.MessageHandled(l.queue, tid, time.Since(start), err)
+
+	if err != nil {
+		lg.Error(err, "Cannot handle message", "queue", l.queue, "type", tid)
+		spanError(span, err)
+	}
+
+	switch mode {
+	case AckAuto:
+
+	case AckManual:
+		if !dh.Settled() {
+			lg.Warn("Message not acknowledged by handler", "queue", l.queue, "type", tid)
+		}
+
+	default:
+		l.settle(d, err)
+	}
+}
+
+// reject rejects a delivery unless it was already
+// acknowledged by the broker.
+func reject(mode AckMode, d amqp.Delivery) {
+	if mode != AckAuto {
+		d.Reject(false)
+	}
+}
+
+func (l *Listener) setMetrics(m metrics.Metrics) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.metrics = m
+}
+
+// handler returns the handler registered for a type id
+// or the default one if there is none.
+func (l *Listener) handler(typeID string) (broker.Handler, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	h, ok := l.handlers[typeID]
+	if ok {
+		return h, nil
+	}
+
+	if l.fallback != nil {
+		return l.fallback, nil
+	}
+
+	return nil, fmt.Errorf("no mapping nor handler for message type '%s'", typeID)
+}
+
+func (l *Listener) hasHandlers() bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	return len(l.handlers) > 0 || l.fallback != nil
+}
+
+// typeID returns delivery message type id.
+// Type property has precedence over TypeIDHeader.
+func typeID(d amqp.Delivery) string {
+	if d.Type != "" {
+		return d.Type
+	}
+
+	tid, _ := d.Headers[TypeIDHeader].(string)
+	return tid
+}
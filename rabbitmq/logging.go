@@ -0,0 +1,49 @@
+package rabbitmq
+
+import (
+	"context"
+
+	"github.com/streadway/amqp"
+	"gitlab.com/mikrowezel/backend/log"
+)
+
+// DeliveryLogger returns the logger of the message being handled
+// in a listener handler context. It adds queue, type, message-id,
+// correlation-id and attempt fields to its output.
+//
+// Note that the log package only adds these fields to entries
+// logged with at least one key-value pair, i.e. they are added to
+// lg.Info("Order created", "order", id) but not to
+// lg.Info("Order created").
+func DeliveryLogger(ctx context.Context) (*log.Logger, bool) {
+	return log.CtxLogger(ctx)
+}
+
+// withLogger returns a copy of ctx containing a logger
+// that adds delivery fields to its output.
+// It is derived from the logger in ctx, if any, otherwise from the
+// listener one. Dynamic fields of the logger in ctx are replaced
+// since the log package does not expose them.
+func (l *Listener) withLogger(ctx context.Context, d amqp.Delivery, typeID string) (context.Context, *log.Logger) {
+	base, ok := log.CtxLogger(ctx)
+	if !ok || base == nil {
+		base = l.log
+	}
+
+	ctx = log.InCtx(ctx)
+
+	lg, _ := log.CtxLogger(ctx)
+	*lg = *base
+
+	// AddDyna stores each key-value pair as a single field
+	// so they are all set at once.
+	lg.SetDyna(
+		"queue", l.queue,
+		"type", typeID,
+		"message-id", d.MessageId,
+		"correlation-id", d.CorrelationId,
+		"attempt", Attempt(d)+1,
+	)
+
+	return ctx, lg
+}
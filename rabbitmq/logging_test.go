@@ -0,0 +1,49 @@
+package rabbitmq
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streadway/amqp"
+	"gitlab.com/mikrowezel/backend/log"
+)
+
+func TestWithLoggerDerivesFromContextLogger(t *testing.T) {
+	ctx := log.InCtx(context.Background())
+	app, _ := log.CtxLogger(ctx)
+	app.Version = "app-version"
+
+	l := &Listener{queue: "orders", log: log.NewLogger(log.Error, "listener")}
+
+	dctx, lg := l.withLogger(ctx, amqp.Delivery{MessageId: "message-1"}, "order.created")
+
+	if lg == app {
+		t.Fatal("delivery logger is the context one")
+	}
+
+	if lg.Version != "app-version" {
+		t.Errorf("delivery logger not derived from context logger")
+	}
+
+	got, ok := DeliveryLogger(dctx)
+	if !ok || got != lg {
+		t.Error("delivery logger not found in handler context")
+	}
+
+	if got, _ := log.CtxLogger(ctx); got != app {
+		t.Error("context logger replaced")
+	}
+}
+
+func TestWithLoggerDerivesFromListenerLogger(t *testing.T) {
+	ll := log.NewLogger(log.Error, "listener")
+	ll.Version = "listener-version"
+
+	l := &Listener{queue: "orders", log: ll}
+
+	_, lg := l.withLogger(context.Background(), amqp.Delivery{}, "order.created")
+
+	if lg == ll || lg.Version != "listener-version" || lg.Level != log.Error {
+		t.Error("delivery logger not derived from listener logger")
+	}
+}
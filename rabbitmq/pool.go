@@ -0,0 +1,201 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+	"gitlab.com/mikrowezel/backend/log"
+)
+
+// NewChannelPool returns a pool that keeps at most
+// size channels open on conn.
+func NewChannelPool(conn *amqp.Connection, size int, log *log.Logger) *ChannelPool {
+	if size < 1 {
+		size = 1
+	}
+
+	return &ChannelPool{
+		conn:  conn,
+		slots: make(chan struct{}, size),
+		log:   log,
+	}
+}
+
+// Get checks out a channel from the pool.
+// It blocks while all channels are checked out
+// until one is returned or ctx is done.
+// Returned channel must be given back using Put.
+func (p *ChannelPool) Get(ctx context.Context) (*Channel, error) {
+	select {
+	case p.slots <- struct{}{}:
+
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		<-p.slots
+		return nil, errors.New("channel pool closed")
+	}
+
+	for len(p.idle) > 0 {
+		ch := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+
+		if ch.Open() {
+			return ch, nil
+		}
+	}
+
+	ch, err := p.open()
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+// Put returns a channel to the pool.
+// Closed channels are discarded so they are
+// replaced by a new one on next checkout.
+func (p *ChannelPool) Put(ch *Channel) {
+	if ch == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed || !ch.Open() || ch.conn != p.conn {
+		ch.Close()
+	} else {
+		p.idle = append(p.idle, ch)
+	}
+
+	<-p.slots
+}
+
+// Discard closes a checked out channel and frees its slot.
+// It must be used instead of Put for channels an operation
+// failed on since the broker may have closed them even if
+// closing has not been noticed yet.
+func (p *ChannelPool) Discard(ch *Channel) {
+	if ch == nil {
+		return
+	}
+
+	ch.Close()
+	<-p.slots
+}
+
+// IsOpen returns true if the pool is not closed
+// and its connection is open.
+func (p *ChannelPool) IsOpen() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return !p.closed && p.conn != nil && !p.conn.IsClosed()
+}
+
+// Size returns the max number of channels in the pool.
+func (p *ChannelPool) Size() int {
+	return cap(p.slots)
+}
+
+// InUse returns the number of channels checked out.
+func (p *ChannelPool) InUse() int {
+	return len(p.slots)
+}
+
+// Reset discards idle channels and makes the pool
+// open new ones on conn.
+// Channels checked out are discarded when returned.
+func (p *ChannelPool) Reset(conn *amqp.Connection) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, ch := range p.idle {
+		ch.Close()
+	}
+
+	p.idle = nil
+	p.conn = conn
+}
+
+// Close closes idle channels and makes the pool
+// refuse new checkouts.
+func (p *ChannelPool) Close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, ch := range p.idle {
+		ch.Close()
+	}
+
+	p.idle = nil
+	p.closed = true
+}
+
+// open opens a new channel and watches its health.
+// Pool mutex must be held by the caller.
+func (p *ChannelPool) open() (*Channel, error) {
+	if p.conn == nil || p.conn.IsClosed() {
+		return nil, errors.New("no active connection")
+	}
+
+	c, err := p.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("cannot open channel: %s", err)
+	}
+
+	ch := newChannel(p.conn, c)
+
+	go func() {
+		err := <-c.NotifyClose(make(chan *amqp.Error, 1))
+		ch.setClosed()
+		if err != nil {
+			p.log.Info("Channel closed", "id", ch.ID.String(), "reason", err.Reason)
+		}
+	}()
+
+	return ch, nil
+}
+
+func newChannel(conn *amqp.Connection, c *amqp.Channel) *Channel {
+	return &Channel{
+		mutex:   &sync.Mutex{},
+		conn:    conn,
+		ID:      uuid.New(),
+		Channel: c,
+		IsOpen:  true,
+	}
+}
+
+// Open returns true if channel is open.
+func (ch *Channel) Open() bool {
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+
+	return ch.IsOpen
+}
+
+// Close closes the underlying AMQP channel.
+func (ch *Channel) Close() error {
+	ch.setClosed()
+	return ch.Channel.Close()
+}
+
+func (ch *Channel) setClosed() {
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+
+	ch.IsOpen = false
+}
@@ -4,13 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/streadway/amqp"
+	"gitlab.com/mikrowezel/backend/broker"
 	"gitlab.com/mikrowezel/backend/broker/mapper"
+	"gitlab.com/mikrowezel/backend/broker/metrics"
 	"gitlab.com/mikrowezel/backend/log"
 )
 
+var _ broker.Broker = (*RabbitMQ)(nil)
+
 // NewRabbitMQ creates and return a new RabbitMQ broker.
 func NewRabbitMQ(ctx context.Context, cfg *Config, log *log.Logger) (*RabbitMQ, error) {
 	r, err := newRabbitMQ(ctx, cfg, log)
@@ -19,6 +25,10 @@ func NewRabbitMQ(ctx context.Context, cfg *Config, log *log.Logger) (*RabbitMQ,
 
 // newRabbitMQ create a new RabbitMQ broker handler.
 func newRabbitMQ(ctx context.Context, cfg *Config, log *log.Logger) (*RabbitMQ, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	r := &RabbitMQ{
 		// Generic
 		ctx:       ctx,
@@ -27,19 +37,43 @@ func newRabbitMQ(ctx context.Context, cfg *Config, log *log.Logger) (*RabbitMQ,
 		ready:     false,
 		alive:     false,
 		log:       log,
+		metrics:   metrics.NewNop(),
+		tracer:    newTracer(nil),
+		Exchanges: make(map[string]*Exchange),
+		Queues:    make(map[string]*Queue),
+		Bindings:  make(map[string]*Binding),
 		Listeners: make(map[string]*Listener),
 		Emitters:  make(map[string]*Emitter),
+		done:      make(chan struct{}),
 	}
 
 	r.conn = <-r.RetryConnection()
-	chs, errs := r.RetryChannel(10)
-	select {
-	case ch := <-chs:
-		r.Channels[ch] = ch.IsOpen
+	if r.conn == nil {
+		return r, errors.New("cannot connect to RabbitMQ broker")
+	}
+
+	r.alive = true
 
-	case err := <-errs:
-		r.log.Error(err)
+	r.Channels = NewChannelPool(r.conn, int(cfg.ChannelPoolSize()), r.log)
+
+	err := r.DeclareTopology()
+	if err != nil {
+		r.Channels.Close()
+		r.conn.Close()
+		r.alive = false
+		return r, err
 	}
+
+	r.setReady(true)
+
+	go r.supervise()
+	go r.teardown()
+
+	interval := cfg.StatsInterval()
+	if interval > 0 {
+		r.StartStatsPoller(time.Duration(interval) * time.Millisecond)
+	}
+
 	return r, nil
 }
 
@@ -48,6 +82,27 @@ func (cfg *Config) Update(c Cfg) {
 	cfg.Cfg = c
 }
 
+// SetMetrics sets the metrics recorder used by the handler
+// and its registered listeners and emitters.
+func (r *RabbitMQ) SetMetrics(m metrics.Metrics) {
+	if m == nil {
+		m = metrics.NewNop()
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.metrics = m
+
+	for _, e := range r.Emitters {
+		e.setMetrics(m)
+	}
+
+	for _, l := range r.Listeners {
+		l.setMetrics(m)
+	}
+}
+
 // SetConfig for RabbitMQ client.
 func (r *RabbitMQ) SetConfig(cfg *Config) {
 	r.cfg = cfg
@@ -58,13 +113,14 @@ func (cfg *Config) Name() string {
 	return cfg.ValAsString("rabbitmq.handler.name", "rabbitmq-handler")
 }
 
-// URL build a connection URL to Rabbit using current host and port.
+// URL build a connection URL to Rabbit using current host, port and vhost.
 func (cfg *Config) URL() string {
 	user := cfg.ValAsString("rabbitmq.user", "")
 	pass := cfg.ValAsString("rabbitmq.pass", "")
 	host := cfg.ValAsString("rabbitmq.host", "localhost")
 	port := cfg.ValAsInt("rabbitmq.port", 5672)
-	return fmt.Sprintf("amqp://%s:%s@%s:%s", user, pass, host, port)
+	vhost := url.PathEscape(cfg.VHost())
+	return fmt.Sprintf("amqp://%s:%s@%s:%d/%s", user, pass, host, port, vhost)
 }
 
 // BackoffMaxTries returns the max ammount of connection retries.
@@ -72,50 +128,126 @@ func (cfg *Config) BackoffMaxTries() int64 {
 	return cfg.ValAsInt("rabbitmq.backoff.maxtries", 10)
 }
 
+// ChannelPoolSize returns the max ammount of channels
+// the handler keeps open for its own operations.
+func (cfg *Config) ChannelPoolSize() int64 {
+	return cfg.ValAsInt("rabbitmq.channels.poolsize", 8)
+}
+
+// EmitterBufferSize returns the max ammount of messages
+// an emitter can queue before blocking callers.
+func (cfg *Config) EmitterBufferSize() int64 {
+	return cfg.ValAsInt("rabbitmq.emitter.buffersize", 64)
+}
+
+// ListenerConcurrency returns the default number
+// of consumers started by each listener.
+func (cfg *Config) ListenerConcurrency() int64 {
+	return cfg.ValAsInt("rabbitmq.listener.concurrency", 1)
+}
+
+// PrefetchCount returns the default QoS prefetch count
+// of listener consumer channels.
+func (cfg *Config) PrefetchCount() int64 {
+	return cfg.ValAsInt("rabbitmq.listener.prefetch.count", 10)
+}
+
+// PrefetchSize returns the default QoS prefetch size
+// in bytes of listener consumer channels.
+func (cfg *Config) PrefetchSize() int64 {
+	return cfg.ValAsInt("rabbitmq.listener.prefetch.size", 0)
+}
+
+// ShutdownTimeout returns the max time in milliseconds
+// Close waits for in-flight work to finish.
+func (cfg *Config) ShutdownTimeout() int64 {
+	return cfg.ValAsInt("rabbitmq.shutdown.timeout", 30000)
+}
+
 // Connect to RabbitMQ.
 func (r *RabbitMQ) Connect(retry bool) error {
 	if r.cfg == nil {
 		return errors.New("no available configuration")
 	}
+
+	var conn *amqp.Connection
+	var err error
+
 	if retry {
-		r.conn = <-r.RetryConnection()
+		conn = <-r.RetryConnection()
+		if conn == nil {
+			err = errors.New("cannot connect to RabbitMQ broker")
+		}
+	} else {
+		conn, err = r.Connection()
 	}
 
-	var err error
-	r.conn, err = r.Connection()
-	return err
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.conn = conn
+
+	if r.Channels == nil {
+		r.Channels = NewChannelPool(conn, int(r.cfg.ChannelPoolSize()), r.log)
+	} else {
+		r.Channels.Reset(conn)
+	}
+
+	return nil
 }
 
-// Channel returns an *amqp.Channel
-func (r *RabbitMQ) Channel() (*amqp.Channel, error) {
-	for ch, valid := range r.Channels {
-		if valid {
-			return ch.Channel, nil
-		}
+// Channel checks out a channel from the handler pool.
+// Returned channel must be given back using ReleaseChannel,
+// its underlying AMQP channel is available in its Channel field.
+// Earlier versions returned an *amqp.Channel that was never
+// released, callers must now use ch.Channel and ReleaseChannel.
+func (r *RabbitMQ) Channel() (*Channel, error) {
+	return r.ChannelContext(r.ctx)
+}
+
+// ChannelContext is like Channel but it stops
+// waiting for an available channel when ctx is done.
+func (r *RabbitMQ) ChannelContext(ctx context.Context) (*Channel, error) {
+	return r.Channels.Get(ctx)
+}
+
+// ReleaseChannel returns a channel to the handler pool.
+func (r *RabbitMQ) ReleaseChannel(ch *Channel) {
+	r.Channels.Put(ch)
+}
+
+// releaseChannel returns a channel to the handler pool
+// or discards it if the operation performed on it failed.
+func (r *RabbitMQ) releaseChannel(ch *Channel, err error) {
+	if err != nil {
+		r.Channels.Discard(ch)
+		return
 	}
-	return nil, errors.New("cannot get a channel")
+
+	r.Channels.Put(ch)
 }
 
 // IsConnected returns true if broker
 // connection is open.
 func (r *RabbitMQ) IsConnected() bool {
-	return !r.conn.IsClosed()
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.conn != nil && !r.conn.IsClosed()
 }
 
 // AddExchange to the broker handler.
 func (r *RabbitMQ) AddExchange(name, kind string, durable, autodelete, internal, nowait bool) error {
-	if r.IsConnected() {
-		return errors.New("no active connection")
-	}
-
-	ch, err := r.Channel()
-	if err != nil {
-		return err
-	}
-
-	ch.ExchangeDeclare(name, kind, durable, autodelete, internal, nowait, nil)
+	return r.AddExchangeContext(r.ctx, name, kind, durable, autodelete, internal, nowait)
+}
 
-	r.Exchanges[name] = &Exchange{
+// AddExchangeContext is like AddExchange but gives up when ctx is done.
+func (r *RabbitMQ) AddExchangeContext(ctx context.Context, name, kind string, durable, autodelete, internal, nowait bool) error {
+	return r.declareExchange(ctx, &Exchange{
 		ID:         uuid.New(),
 		Name:       name,
 		Kind:       kind,
@@ -123,9 +255,7 @@ func (r *RabbitMQ) AddExchange(name, kind string, durable, autodelete, internal,
 		AutoDelete: autodelete,
 		Internal:   internal,
 		NoWait:     nowait,
-	}
-
-	return nil
+	})
 }
 
 // AddListener to the broker
@@ -134,52 +264,193 @@ func (r *RabbitMQ) AddListener(name, exchange, queue string) error {
 	if err != nil {
 		return err
 	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
 	r.Listeners[name] = l
 	return nil
 }
 
+// AddQueue declares a queue in the broker
+// and registers it into the handler.
+func (r *RabbitMQ) AddQueue(name string, opts QueueOptions) error {
+	return r.AddQueueContext(r.ctx, name, opts)
+}
+
+// AddQueueContext is like AddQueue but gives up when ctx is done.
+func (r *RabbitMQ) AddQueueContext(ctx context.Context, name string, opts QueueOptions) error {
+	return r.declareQueue(ctx, &Queue{
+		ID:         uuid.New().String(),
+		Name:       name,
+		Durable:    opts.Durable,
+		AutoDelete: opts.AutoDelete,
+		Exclusive:  opts.Exclusive,
+		NoWait:     opts.NoWait,
+		ArgsTable:  opts.Args,
+	})
+}
+
+// AddBinding binds a queue to an exchange using a routing key
+// and registers the binding into the handler.
+func (r *RabbitMQ) AddBinding(exchange, queue, routingKey string, args map[string]interface{}) error {
+	return r.AddBindingContext(r.ctx, exchange, queue, routingKey, args)
+}
+
+// AddBindingContext is like AddBinding but gives up when ctx is done.
+func (r *RabbitMQ) AddBindingContext(ctx context.Context, exchange, queue, routingKey string, args map[string]interface{}) error {
+	r.mutex.RLock()
+	e, ok := r.Exchanges[exchange]
+	if !ok {
+		e = &Exchange{Name: exchange}
+	}
+
+	q, ok := r.Queues[queue]
+	if !ok {
+		q = &Queue{Name: queue}
+	}
+	r.mutex.RUnlock()
+
+	return r.declareBinding(ctx, &Binding{
+		ID:         uuid.New().String(),
+		Name:       bindingName(exchange, queue, routingKey),
+		Exchange:   e,
+		Queue:      q,
+		RoutingKey: routingKey,
+		ArgsTable:  args,
+	})
+}
+
 // AddEmitter to the broker.
 // queue parameter is optional but if it is provided
-// a queue and binding to the exchange will be created
-// for each provided name.
+// a durable queue and binding to the exchange will be created
+// for each provided name using it as routing key.
 func (r *RabbitMQ) AddEmitter(name, exchange string, queue ...string) error {
-	if len(queue) < 1 {
-		queue = []string{""} //TODO: Implement (multiple) queue binding
+	for _, q := range queue {
+		// Keep the declaration of an already registered queue.
+		if r.queue(q) == nil {
+			err := r.AddQueue(q, QueueOptions{Durable: true})
+			if err != nil {
+				return err
+			}
+		}
+
+		err := r.AddBinding(exchange, q, q, nil)
+		if err != nil {
+			return err
+		}
 	}
 
-	e, err := r.NewEmitter(exchange, queue[0])
+	e, err := r.NewEmitter(exchange)
 	if err != nil {
 		return err
 	}
 
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
 	r.Emitters[name] = e
 	return nil
 }
 
+// Publish sends a message through a registered emitter.
+func (r *RabbitMQ) Publish(emitter, routingKey string, msg broker.BaseMessage) error {
+	return r.PublishContext(r.ctx, emitter, routingKey, msg)
+}
+
+// PublishContext is like Publish but gives up when ctx is done.
+func (r *RabbitMQ) PublishContext(ctx context.Context, emitter, routingKey string, msg broker.BaseMessage) error {
+	r.mutex.RLock()
+	e, ok := r.Emitters[emitter]
+	r.mutex.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("emitter '%s' not found", emitter)
+	}
+
+	return e.EmitContext(ctx, msg, routingKey)
+}
+
+// Subscribe passes messages received by a registered listener to a handler.
+func (r *RabbitMQ) Subscribe(listener string, h broker.Handler) error {
+	return r.SubscribeContext(r.ctx, listener, h)
+}
+
+// SubscribeContext is like Subscribe but handlers receive contexts
+// derived from ctx and listener stops when it is done.
+func (r *RabbitMQ) SubscribeContext(ctx context.Context, listener string, h broker.Handler) error {
+	r.mutex.RLock()
+	l, ok := r.Listeners[listener]
+	r.mutex.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("listener '%s' not found", listener)
+	}
+
+	return l.ListenContext(ctx, h)
+}
+
+// Close gracefully shuts down the handler waiting
+// at most the configured shutdown timeout.
+func (r *RabbitMQ) Close() error {
+	timeout := time.Duration(r.cfg.ShutdownTimeout()) * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return r.Shutdown(ctx)
+}
+
 // NewListener returns a new RabbitMQ broker listener.
 func (r *RabbitMQ) NewListener(exchange, queue string) (*Listener, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
 	if r.conn == nil {
 		return nil, errors.New("broker has no connection")
 	}
 
 	return &Listener{
-		connection: r.conn,
-		exchange:   exchange,
-		queue:      queue,
-		mapper:     mapper.NewMessageMapper(),
-		log:        r.log,
+		ctx:           r.ctx,
+		owner:         r,
+		connection:    r.conn,
+		exchange:      exchange,
+		queue:         queue,
+		mapper:        mapper.NewMessageMapper(),
+		handlers:      make(map[string]broker.Handler),
+		concurrency:   int(r.cfg.ListenerConcurrency()),
+		prefetchCount: int(r.cfg.PrefetchCount()),
+		prefetchSize:  int(r.cfg.PrefetchSize()),
+		ackMode:       r.cfg.AckMode(),
+		metrics:       r.metrics,
+		tracer:        r.tracer,
+		resumed:       make(chan struct{}),
+		log:           r.log,
 	}, nil
 }
 
 // NewEmitter returns a new RabbitMQ broker emitter.
-func (r *RabbitMQ) NewEmitter(exchange, queue string) (*Emitter, error) {
+func (r *RabbitMQ) NewEmitter(exchange string) (*Emitter, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
 	if r.conn == nil {
 		return nil, errors.New("broker has no connection")
 	}
 
-	return &Emitter{
+	e := &Emitter{
 		connection: r.conn,
 		exchange:   exchange,
+		events:     make(chan *EmittedBaseMessage, r.cfg.EmitterBufferSize()),
+		stopped:    make(chan struct{}),
+		closing:    make(chan struct{}),
+		resumed:    make(chan struct{}, 1),
+		metrics:    r.metrics,
+		tracer:     r.tracer,
 		log:        r.log,
-	}, nil
+	}
+
+	go e.run()
+
+	return e, nil
 }
@@ -0,0 +1,124 @@
+package rabbitmq
+
+import (
+	"errors"
+
+	"github.com/streadway/amqp"
+)
+
+// supervise watches handler connection and when it is lost
+// reconnects, declares again the registered topology and
+// resumes all registered listeners and emitters.
+func (r *RabbitMQ) supervise() {
+	for {
+		r.mutex.RLock()
+		conn := r.conn
+		r.mutex.RUnlock()
+
+		amqpErr := <-conn.NotifyClose(make(chan *amqp.Error, 1))
+		if r.isClosed() {
+			return
+		}
+
+		r.log.Error(amqpErr, "RabbitMQ connection lost")
+		r.setReady(false)
+
+		for !r.isClosed() && r.ctx.Err() == nil {
+			err := r.recover()
+			if err == nil {
+				break
+			}
+
+			if !r.isClosed() {
+				r.log.Error(err, "RabbitMQ recovery failed")
+			}
+		}
+	}
+}
+
+// recover reconnects the handler and restores its state.
+func (r *RabbitMQ) recover() error {
+	conn := <-r.RetryConnection()
+	if conn == nil {
+		return errors.New("cannot reconnect to RabbitMQ broker")
+	}
+
+	// Handler may have been shut down while dialing.
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		conn.Close()
+		return errors.New("handler shut down during recovery")
+	}
+	r.conn = conn
+	r.mutex.Unlock()
+
+	r.Channels.Reset(conn)
+
+	err := r.redeclare()
+	if err != nil {
+		return err
+	}
+
+	r.mutex.RLock()
+	for _, e := range r.Emitters {
+		e.resume(conn)
+	}
+
+	for _, l := range r.Listeners {
+		l.resume(conn)
+	}
+	r.mutex.RUnlock()
+
+	r.setReady(true)
+
+	r.mutex.RLock()
+	r.metrics.Reconnected()
+	r.mutex.RUnlock()
+	r.log.Info("RabbitMQ connection recovered")
+	return nil
+}
+
+// redeclare declares registered exchanges, queues and bindings.
+func (r *RabbitMQ) redeclare() error {
+	c, err := r.Channel()
+	if err != nil {
+		return err
+	}
+	defer func() { r.releaseChannel(c, err) }()
+
+	ch := c.Channel
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, e := range r.Exchanges {
+		err = ch.ExchangeDeclare(e.Name, e.Kind, e.Durable, e.AutoDelete, e.Internal, e.NoWait, e.ArgsTable)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, q := range r.Queues {
+		_, err = ch.QueueDeclare(q.Name, q.Durable, q.AutoDelete, q.Exclusive, q.NoWait, q.ArgsTable)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, b := range r.Bindings {
+		err = ch.QueueBind(b.Queue.Name, b.RoutingKey, b.Exchange.Name, false, b.ArgsTable)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *RabbitMQ) isClosed() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.closed
+}
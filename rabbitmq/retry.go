@@ -0,0 +1,265 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+)
+
+// RetryAttemptHeader is the header used to track
+// the number of times a message has been retried.
+const RetryAttemptHeader = "x-retry-attempt"
+
+const messageTTLArg = "x-message-ttl"
+
+// retryConfirmTimeout is the time a listener waits for the broker
+// to confirm a message sent to a retry or parking queue.
+const retryConfirmTimeout = 5 * time.Second
+
+// SetRetryPolicy makes messages whose handler fails with an error
+// classified as DispositionRetry to be delivered again after each one
+// of the delays instead of being immediately requeued. Once delays are exhausted messages are
+// sent to the listener parking queue.
+// It must be set before listening, a TTL queue for each delay and the
+// parking queue are declared alongside the listener queue.
+// Messages are acknowledged only after the broker confirms their
+// copy in the retry or parking queue, otherwise they are requeued.
+func (l *Listener) SetRetryPolicy(delays ...time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.retryDelays = delays
+}
+
+// RetryQueue returns the name of the queue used to delay
+// messages for a retry delay.
+func (l *Listener) RetryQueue(delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%dms", l.queue, delay/time.Millisecond)
+}
+
+// ParkingQueue returns the name of the queue where messages
+// that exhausted the retry policy are sent.
+func (l *Listener) ParkingQueue() string {
+	return l.queue + ".parking"
+}
+
+// retryQueues returns the retry TTL queues and parking queue.
+// Expired messages are dead-lettered back to the listener queue
+// through the default exchange.
+// Listener mutex must be held by the caller.
+func (l *Listener) retryQueues() ([]*Queue, error) {
+	if len(l.retryDelays) == 0 {
+		return nil, nil
+	}
+
+	if l.queue == "" {
+		return nil, errors.New("retry policy requires a named queue")
+	}
+
+	var queues []*Queue
+	for _, d := range l.retryDelays {
+		queues = append(queues, &Queue{
+			ID:      uuid.New().String(),
+			Name:    l.RetryQueue(d),
+			Durable: true,
+			ArgsTable: amqp.Table{
+				messageTTLArg:           int64(d / time.Millisecond),
+				deadLetterExchangeArg:   "",
+				deadLetterRoutingKeyArg: l.queue,
+			},
+		})
+	}
+
+	queues = append(queues, &Queue{
+		ID:      uuid.New().String(),
+		Name:    l.ParkingQueue(),
+		Durable: true,
+	})
+
+	return queues, nil
+}
+
+// retry sends a failed message to the next retry queue
+// or to the parking queue if there are no more retries left.
+// It returns false if listener has no retry policy.
+func (l *Listener) retry(d amqp.Delivery) (bool, error) {
+	l.mutex.RLock()
+	delays := l.retryDelays
+	l.mutex.RUnlock()
+
+	if len(delays) == 0 {
+		return false, nil
+	}
+
+	attempt := Attempt(d)
+
+	queue := l.ParkingQueue()
+	if attempt < len(delays) {
+		queue = l.RetryQueue(delays[attempt])
+	}
+
+	p := republishing(d)
+	p.Headers[RetryAttemptHeader] = int64(attempt + 1)
+
+	return true, l.republish(queue, p)
+}
+
+// republish sends a message to a queue through the default exchange
+// in mandatory mode and waits until the broker confirms it, so that
+// the original delivery is only acknowledged once the copy is safe.
+func (l *Listener) republish(queue string, p amqp.Publishing) error {
+	l.retryMutex.Lock()
+	defer l.retryMutex.Unlock()
+
+	rp, err := l.retryPublisher()
+	if err != nil {
+		return err
+	}
+
+	err = rp.publish(queue, p)
+	if err != nil {
+		// Pending confirmations, if any, would be
+		// taken as those of the next publications.
+		rp.channel.Close()
+		l.retryPub = nil
+	}
+
+	return err
+}
+
+// retryPublisher returns the channel used to send messages to
+// retry and parking queues opening a new one if needed.
+// Listener retry mutex must be held by the caller.
+func (l *Listener) retryPublisher() (*retryPublisher, error) {
+	if l.retryPub != nil {
+		select {
+		case <-l.retryPub.closed:
+			l.retryPub = nil
+
+		default:
+			return l.retryPub, nil
+		}
+	}
+
+	l.mutex.RLock()
+	conn := l.connection
+	l.mutex.RUnlock()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("cannot open retry channel: %s", err)
+	}
+
+	err = ch.Confirm(false)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("cannot put retry channel in confirm mode: %s", err)
+	}
+
+	// Messages are published one at a time.
+	l.retryPub = &retryPublisher{
+		channel:  ch,
+		confirms: ch.NotifyPublish(make(chan amqp.Confirmation, 1)),
+		returns:  ch.NotifyReturn(make(chan amqp.Return, 1)),
+		closed:   ch.NotifyClose(make(chan *amqp.Error, 1)),
+	}
+
+	return l.retryPub, nil
+}
+
+// closeRetryPublisher closes the retry channel, if any.
+func (l *Listener) closeRetryPublisher() {
+	l.retryMutex.Lock()
+	defer l.retryMutex.Unlock()
+
+	if l.retryPub != nil {
+		l.retryPub.channel.Close()
+		l.retryPub = nil
+	}
+}
+
+// publish sends a message and waits for its confirmation.
+// A returned message fails with ErrUnroutable.
+func (rp *retryPublisher) publish(queue string, p amqp.Publishing) error {
+	err := rp.channel.Publish("", queue, true, false, p)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case c, ok := <-rp.confirms:
+		if !ok {
+			return ErrChannelClosed
+		}
+
+		// A return is queued before the confirmation that follows it.
+		select {
+		case ret := <-rp.returns:
+			return unroutable(ret)
+
+		default:
+		}
+
+		if !c.Ack {
+			return ErrNacked
+		}
+
+		return nil
+
+	case <-time.After(retryConfirmTimeout):
+		return ErrConfirmTimeout
+	}
+}
+
+// Attempt returns the number of times a delivery has been retried.
+func Attempt(d amqp.Delivery) int {
+	switch v := d.Headers[RetryAttemptHeader].(type) {
+	case int64:
+		return int(v)
+	case int32:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
+
+// RetryAttempt returns the number of times the message
+// being handled in ctx has been retried.
+func RetryAttempt(ctx context.Context) int {
+	d, ok := DeliveryFromContext(ctx)
+	if !ok {
+		return 0
+	}
+
+	return Attempt(d)
+}
+
+// republishing returns a publishing that is a copy of a delivery.
+func republishing(d amqp.Delivery) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		UserId:          d.UserId,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+}
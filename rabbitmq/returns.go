@@ -0,0 +1,103 @@
+package rabbitmq
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+)
+
+// ErrUnroutable is reported when a message published
+// in mandatory mode cannot be routed to any queue.
+type ErrUnroutable struct {
+	ReplyCode  uint16
+	ReplyText  string
+	Exchange   string
+	RoutingKey string
+	MessageID  string
+	TypeID     string
+}
+
+// ReturnHandler processes messages returned by the broker
+// that cannot be reported to the emitting caller.
+type ReturnHandler func(err *ErrUnroutable)
+
+// Error returns a human readable description of the error.
+func (e *ErrUnroutable) Error() string {
+	return fmt.Sprintf("unroutable message %s: %d %s (exchange: '%s', routing key: '%s')",
+		e.TypeID, e.ReplyCode, e.ReplyText, e.Exchange, e.RoutingKey)
+}
+
+// SetMandatory puts emitter in mandatory mode.
+// In this mode messages that cannot be routed to any queue
+// are returned by the broker.
+// If emitter is also in confirm mode the error is reported
+// to the emitting caller, otherwise it is passed to the
+// registered returns handler.
+func (e *Emitter) SetMandatory(mandatory bool) {
+	e.mutex.Lock()
+	e.mandatory = mandatory
+	e.mutex.Unlock()
+
+	// Next publication opens a channel in the new mode.
+	e.resetChannel()
+}
+
+// IsMandatory returns true if emitter is in mandatory mode.
+func (e *Emitter) IsMandatory() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.mandatory
+}
+
+// HandleReturns registers the handler for returned messages
+// that cannot be correlated to a waiting emission.
+func (e *Emitter) HandleReturns(h ReturnHandler) {
+	e.hooksMutex.Lock()
+	defer e.hooksMutex.Unlock()
+
+	e.onReturn = h
+}
+
+// listenReturns passes returned messages to the returns handler.
+func (e *Emitter) listenReturns(returns <-chan amqp.Return) {
+	for ret := range returns {
+		e.returned(unroutable(ret))
+	}
+}
+
+// returned passes an unroutable message error to the
+// returns handler or logs it if there is none.
+func (e *Emitter) returned(err *ErrUnroutable) {
+	e.hooksMutex.RLock()
+	h := e.onReturn
+	e.hooksMutex.RUnlock()
+
+	if h != nil {
+		h(err)
+		return
+	}
+
+	e.log.Error(err, "Message returned by broker", "exchange", err.Exchange, "routing-key", err.RoutingKey, "type", err.TypeID)
+}
+
+// ensureMessageID sets a message id to the publishing
+// if there is none so that it can be correlated
+// if it is returned by the broker.
+func ensureMessageID(p *amqp.Publishing) {
+	if p.MessageId == "" {
+		p.MessageId = uuid.New().String()
+	}
+}
+
+func unroutable(ret amqp.Return) *ErrUnroutable {
+	return &ErrUnroutable{
+		ReplyCode:  ret.ReplyCode,
+		ReplyText:  ret.ReplyText,
+		Exchange:   ret.Exchange,
+		RoutingKey: ret.RoutingKey,
+		MessageID:  ret.MessageId,
+		TypeID:     ret.Type,
+	}
+}
@@ -0,0 +1,193 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrEmitterClosed is returned when emitting
+// through an emitter that was shut down.
+var ErrEmitterClosed = errors.New("emitter closed")
+
+// flushInterval is the time between checks
+// of pending confirmations while shutting down.
+const flushInterval = 10 * time.Millisecond
+
+// Shutdown gracefully stops the handler.
+// It stops accepting new emits, cancels consumers and waits
+// for in-flight handlers, queued messages and pending confirms
+// until ctx is done. Then it closes channels and connection.
+// If something was left unfinished a *ShutdownError describing
+// it is returned.
+func (r *RabbitMQ) Shutdown(ctx context.Context) error {
+	r.mutex.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.done)
+	}
+	r.ready = false
+	r.mutex.Unlock()
+
+	r.StopStatsPoller()
+
+	r.mutex.RLock()
+	listeners := make(map[string]*Listener, len(r.Listeners))
+	for name, l := range r.Listeners {
+		listeners[name] = l
+	}
+
+	emitters := make(map[string]*Emitter, len(r.Emitters))
+	for name, e := range r.Emitters {
+		emitters[name] = e
+	}
+	r.mutex.RUnlock()
+
+	serr := &ShutdownError{}
+
+	for _, e := range emitters {
+		e.closeEvents()
+	}
+
+	for name, l := range listeners {
+		err := l.stop(ctx)
+		if err == nil {
+			continue
+		}
+
+		if err == ctx.Err() {
+			serr.Listeners = append(serr.Listeners, name)
+			continue
+		}
+
+		serr.Errors = append(serr.Errors, fmt.Errorf("listener %s: %s", name, err))
+	}
+
+	for name, e := range emitters {
+		pending := e.flush(ctx)
+		if pending > 0 {
+			serr.Emitters = append(serr.Emitters, name)
+			serr.Pending += pending
+		}
+
+		e.resetChannel()
+	}
+
+	r.Channels.Close()
+
+	r.mutex.RLock()
+	conn := r.conn
+	r.mutex.RUnlock()
+
+	if conn != nil && !conn.IsClosed() {
+		err := conn.Close()
+		if err != nil {
+			serr.Errors = append(serr.Errors, err)
+		}
+	}
+
+	if len(serr.Listeners) == 0 && len(serr.Emitters) == 0 && len(serr.Errors) == 0 {
+		return nil
+	}
+
+	sort.Strings(serr.Listeners)
+	sort.Strings(serr.Emitters)
+	r.log.Error(serr, "RabbitMQ handler shutdown incomplete")
+	return serr
+}
+
+// teardown shuts down the handler when its context is done.
+func (r *RabbitMQ) teardown() {
+	select {
+	case <-r.ctx.Done():
+		r.log.Info("RabbitMQ handler context done, shutting down")
+
+		err := r.Close()
+		if err != nil {
+			r.log.Error(err, "RabbitMQ handler teardown failed")
+		}
+
+	case <-r.done:
+	}
+}
+
+// Error returns a human readable description of the error.
+func (e *ShutdownError) Error() string {
+	var parts []string
+
+	if len(e.Listeners) > 0 {
+		parts = append(parts, fmt.Sprintf("listeners still handling messages: %s", strings.Join(e.Listeners, ", ")))
+	}
+
+	if len(e.Emitters) > 0 {
+		parts = append(parts, fmt.Sprintf("%d messages pending in emitters: %s", e.Pending, strings.Join(e.Emitters, ", ")))
+	}
+
+	for _, err := range e.Errors {
+		parts = append(parts, err.Error())
+	}
+
+	return "shutdown incomplete: " + strings.Join(parts, "; ")
+}
+
+// closeEvents makes the emitter refuse new emits.
+// Already queued messages are still published.
+// Emits waiting for room in the queue are released
+// before taking the events lock they hold.
+func (e *Emitter) closeEvents() {
+	e.closingOnce.Do(func() {
+		close(e.closing)
+	})
+
+	e.eventsMutex.Lock()
+	defer e.eventsMutex.Unlock()
+
+	if e.closed {
+		return
+	}
+
+	e.closed = true
+	close(e.events)
+}
+
+// flush waits until queued messages are published and,
+// in confirm mode, confirmed or until ctx is done.
+// It returns the number of messages left unfinished.
+func (e *Emitter) flush(ctx context.Context) int {
+	select {
+	case <-e.stopped:
+
+	case <-ctx.Done():
+		return len(e.events) + e.waiting()
+	}
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for e.waiting() > 0 {
+		select {
+		case <-ticker.C:
+
+		case <-ctx.Done():
+			return e.waiting()
+		}
+	}
+
+	return 0
+}
+
+// waiting returns the number of messages waiting for confirmation.
+func (e *Emitter) waiting() int {
+	e.mutex.Lock()
+	t := e.tracker
+	e.mutex.Unlock()
+
+	if t == nil {
+		return 0
+	}
+
+	return t.waiting()
+}
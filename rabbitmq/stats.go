@@ -0,0 +1,168 @@
+package rabbitmq
+
+import (
+	"errors"
+	"time"
+)
+
+// StatsInterval returns the queue statistics polling interval
+// in milliseconds, polling is disabled if it is zero.
+func (cfg *Config) StatsInterval() int64 {
+	return cfg.ValAsInt("rabbitmq.stats.interval", 0)
+}
+
+// Inspect refreshes and returns queue statistics using a passive declare.
+// If the queue is registered in the handler its counts are updated.
+func (r *RabbitMQ) Inspect(name string) (QueueStats, error) {
+	ch, err := r.Channel()
+	if err != nil {
+		return QueueStats{}, err
+	}
+	defer func() { r.releaseChannel(ch, err) }()
+
+	q, err := ch.Channel.QueueInspect(name)
+	if err != nil {
+		return QueueStats{}, err
+	}
+
+	stats := QueueStats{
+		Name:      q.Name,
+		Messages:  q.Messages,
+		Consumers: q.Consumers,
+		UpdatedAt: time.Now(),
+	}
+
+	r.mutex.RLock()
+	rq, ok := r.Queues[name]
+	r.mutex.RUnlock()
+
+	if ok {
+		rq.update(stats)
+	}
+
+	return stats, nil
+}
+
+// Stats returns last known queue statistics.
+func (q *Queue) Stats() QueueStats {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	return QueueStats{
+		Name:      q.Name,
+		Messages:  q.Messages,
+		Consumers: q.Consumers,
+		UpdatedAt: q.updatedAt,
+	}
+}
+
+func (q *Queue) update(stats QueueStats) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.Messages = stats.Messages
+	q.Consumers = stats.Consumers
+	q.updatedAt = stats.UpdatedAt
+}
+
+// OnQueueThreshold registers a function to be called when
+// the queue backlog rises above messages.
+// It is not called again until the backlog drops
+// to or below the threshold and rises above it once more.
+// Alerts are only evaluated while the stats poller is running.
+func (r *RabbitMQ) OnQueueThreshold(queue string, messages int, fn QueueAlert) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.alerts = append(r.alerts, &queueAlert{
+		queue:     queue,
+		threshold: messages,
+		fn:        fn,
+	})
+}
+
+// StartStatsPoller periodically refreshes statistics
+// of every registered queue and evaluates threshold alerts.
+func (r *RabbitMQ) StartStatsPoller(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("invalid stats polling interval")
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.statsStop != nil {
+		return errors.New("stats poller already started")
+	}
+
+	r.statsStop = make(chan struct{})
+	go r.pollStats(interval, r.statsStop)
+
+	return nil
+}
+
+// StopStatsPoller stops the stats poller.
+func (r *RabbitMQ) StopStatsPoller() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.statsStop != nil {
+		close(r.statsStop)
+		r.statsStop = nil
+	}
+}
+
+func (r *RabbitMQ) pollStats(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.refreshStats()
+
+		case <-stop:
+			return
+
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// refreshStats inspects every registered queue
+// and evaluates threshold alerts.
+func (r *RabbitMQ) refreshStats() {
+	r.mutex.RLock()
+	names := make([]string, 0, len(r.Queues))
+	for name := range r.Queues {
+		names = append(names, name)
+	}
+	alerts := r.alerts
+	r.mutex.RUnlock()
+
+	for _, name := range names {
+		stats, err := r.Inspect(name)
+		if err != nil {
+			r.log.Error(err, "Cannot inspect queue", "queue", name)
+			continue
+		}
+
+		for _, a := range alerts {
+			if a.queue == name {
+				a.eval(stats)
+			}
+		}
+	}
+}
+
+// eval calls alert function if queue backlog
+// has just risen above threshold.
+func (a *queueAlert) eval(stats QueueStats) {
+	above := stats.Messages > a.threshold
+	if above && !a.triggered {
+		a.fn(stats)
+	}
+
+	a.triggered = above
+}
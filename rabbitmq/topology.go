@@ -0,0 +1,341 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	exchangesKey = "rabbitmq.exchanges."
+	queuesKey    = "rabbitmq.queues."
+	bindingsKey  = "rabbitmq.bindings."
+	argsKey      = "args."
+)
+
+// Topology returns the exchanges, queues and bindings
+// described in configuration.
+//
+// Exchanges are described using keys like:
+//
+//	rabbitmq.exchanges.<id>.name (<id>)
+//	rabbitmq.exchanges.<id>.kind (topic)
+//	rabbitmq.exchanges.<id>.durable (true)
+//	rabbitmq.exchanges.<id>.autodelete (false)
+//	rabbitmq.exchanges.<id>.internal (false)
+//	rabbitmq.exchanges.<id>.args.<argument>
+//
+// Queues using keys like:
+//
+//	rabbitmq.queues.<id>.name (<id>)
+//	rabbitmq.queues.<id>.durable (true)
+//	rabbitmq.queues.<id>.autodelete (false)
+//	rabbitmq.queues.<id>.exclusive (false)
+//	rabbitmq.queues.<id>.args.<argument>
+//
+// And bindings using keys like:
+//
+//	rabbitmq.bindings.<id>.exchange
+//	rabbitmq.bindings.<id>.queue
+//	rabbitmq.bindings.<id>.key
+//	rabbitmq.bindings.<id>.args.<argument>
+//
+// Ids cannot contain dots, the name key sets the broker name
+// of elements whose name does, i.e. orders.events.
+// Bindings refer to exchanges and queues by id, values that
+// are not a configured id are taken as broker names.
+// Argument values that look like integers or booleans
+// are converted to them.
+func (cfg *Config) Topology() (*Topology, error) {
+	t := &Topology{}
+	vals := cfg.Get()
+
+	exchanges := make(map[string]string)
+	for _, id := range names(vals, exchangesKey) {
+		k := exchangesKey + id + "."
+		name := cfg.ValAsString(k+"name", id)
+		exchanges[id] = name
+
+		t.Exchanges = append(t.Exchanges, &Exchange{
+			ID:         uuid.New(),
+			Name:       name,
+			Kind:       cfg.ValAsString(k+"kind", "topic"),
+			Durable:    cfg.ValAsBool(k+"durable", true),
+			AutoDelete: cfg.ValAsBool(k+"autodelete", false),
+			Internal:   cfg.ValAsBool(k+"internal", false),
+			ArgsTable:  args(vals, k+argsKey),
+		})
+	}
+
+	queues := make(map[string]string)
+	for _, id := range names(vals, queuesKey) {
+		k := queuesKey + id + "."
+		name := cfg.ValAsString(k+"name", id)
+		queues[id] = name
+
+		t.Queues = append(t.Queues, &Queue{
+			ID:         uuid.New().String(),
+			Name:       name,
+			Durable:    cfg.ValAsBool(k+"durable", true),
+			AutoDelete: cfg.ValAsBool(k+"autodelete", false),
+			Exclusive:  cfg.ValAsBool(k+"exclusive", false),
+			ArgsTable:  args(vals, k+argsKey),
+		})
+	}
+
+	for _, name := range names(vals, bindingsKey) {
+		k := bindingsKey + name + "."
+		exchange := cfg.ValAsString(k+"exchange", "")
+		queue := cfg.ValAsString(k+"queue", "")
+
+		if exchange == "" || queue == "" {
+			return nil, fmt.Errorf("binding '%s' requires an exchange and a queue", name)
+		}
+
+		if n, ok := exchanges[exchange]; ok {
+			exchange = n
+		}
+
+		if n, ok := queues[queue]; ok {
+			queue = n
+		}
+
+		t.Bindings = append(t.Bindings, &Binding{
+			ID:         uuid.New().String(),
+			Name:       name,
+			Exchange:   t.exchange(exchange),
+			Queue:      t.queue(queue),
+			RoutingKey: cfg.ValAsString(k+"key", ""),
+			ArgsTable:  args(vals, k+argsKey),
+		})
+	}
+
+	return t, nil
+}
+
+// DeclareTopology declares the exchanges, queues and bindings
+// described in handler configuration.
+func (r *RabbitMQ) DeclareTopology() error {
+	if r.cfg == nil {
+		return errors.New("no available configuration")
+	}
+
+	t, err := r.cfg.Topology()
+	if err != nil {
+		return err
+	}
+
+	return r.Declare(t)
+}
+
+// Declare declares a topology in the broker and registers
+// its elements into handler Exchanges, Queues and Bindings.
+func (r *RabbitMQ) Declare(t *Topology) error {
+	return r.DeclareContext(r.ctx, t)
+}
+
+// DeclareContext is like Declare but gives up when ctx is done.
+func (r *RabbitMQ) DeclareContext(ctx context.Context, t *Topology) error {
+	for _, e := range t.Exchanges {
+		err := r.declareExchange(ctx, e)
+		if err != nil {
+			return fmt.Errorf("cannot declare exchange '%s': %s", e.Name, err)
+		}
+	}
+
+	for _, q := range t.Queues {
+		err := r.declareQueue(ctx, q)
+		if err != nil {
+			return fmt.Errorf("cannot declare queue '%s': %s", q.Name, err)
+		}
+	}
+
+	for _, b := range t.Bindings {
+		err := r.declareBinding(ctx, b)
+		if err != nil {
+			return fmt.Errorf("cannot declare binding '%s': %s", b.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *RabbitMQ) declareExchange(ctx context.Context, e *Exchange) error {
+	if !r.IsConnected() {
+		return errors.New("no active connection")
+	}
+
+	ch, err := r.ChannelContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { r.releaseChannel(ch, err) }()
+
+	err = ch.Channel.ExchangeDeclare(e.Name, e.Kind, e.Durable, e.AutoDelete, e.Internal, e.NoWait, e.ArgsTable)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.Exchanges[e.Name] = e
+	return nil
+}
+
+func (r *RabbitMQ) declareQueue(ctx context.Context, q *Queue) error {
+	if !r.IsConnected() {
+		return errors.New("no active connection")
+	}
+
+	ch, err := r.ChannelContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { r.releaseChannel(ch, err) }()
+
+	_, err = ch.Channel.QueueDeclare(q.Name, q.Durable, q.AutoDelete, q.Exclusive, q.NoWait, q.ArgsTable)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.Queues[q.Name] = q
+	return nil
+}
+
+// queue returns the registered queue with a name, if any.
+func (r *RabbitMQ) queue(name string) *Queue {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.Queues[name]
+}
+
+// registerQueues registers queues declared outside the handler
+// so that they are declared again on recovery and exported.
+func (r *RabbitMQ) registerQueues(queues []*Queue) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, q := range queues {
+		if q.Name != "" {
+			r.Queues[q.Name] = q
+		}
+	}
+}
+
+func (r *RabbitMQ) declareBinding(ctx context.Context, b *Binding) error {
+	if !r.IsConnected() {
+		return errors.New("no active connection")
+	}
+
+	ch, err := r.ChannelContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { r.releaseChannel(ch, err) }()
+
+	err = ch.Channel.QueueBind(b.Queue.Name, b.RoutingKey, b.Exchange.Name, false, b.ArgsTable)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Point to registered elements when available.
+	if e, ok := r.Exchanges[b.Exchange.Name]; ok {
+		b.Exchange = e
+	}
+
+	if q, ok := r.Queues[b.Queue.Name]; ok {
+		b.Queue = q
+	}
+
+	r.Bindings[b.Name] = b
+	return nil
+}
+
+func (t *Topology) exchange(name string) *Exchange {
+	for _, e := range t.Exchanges {
+		if e.Name == name {
+			return e
+		}
+	}
+
+	return &Exchange{Name: name}
+}
+
+func (t *Topology) queue(name string) *Queue {
+	for _, q := range t.Queues {
+		if q.Name == name {
+			return q
+		}
+	}
+
+	return &Queue{Name: name}
+}
+
+// names returns the sorted element names of the config keys
+// starting with prefix.
+func names(vals map[string]string, prefix string) []string {
+	set := make(map[string]bool)
+	for k := range vals {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		name := strings.SplitN(strings.TrimPrefix(k, prefix), ".", 2)[0]
+		if name != "" {
+			set[name] = true
+		}
+	}
+
+	ns := make([]string, 0, len(set))
+	for n := range set {
+		ns = append(ns, n)
+	}
+
+	sort.Strings(ns)
+	return ns
+}
+
+// args returns the arguments table of the config keys
+// starting with prefix.
+func args(vals map[string]string, prefix string) map[string]interface{} {
+	var table map[string]interface{}
+
+	for k, v := range vals {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		if table == nil {
+			table = make(map[string]interface{})
+		}
+
+		table[strings.TrimPrefix(k, prefix)] = argValue(v)
+	}
+
+	return table
+}
+
+func argValue(v string) interface{} {
+	if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return i
+	}
+
+	if b, err := strconv.ParseBool(v); err == nil {
+		return b
+	}
+
+	return v
+}
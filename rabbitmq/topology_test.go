@@ -0,0 +1,161 @@
+package rabbitmq
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// testCfg is a Cfg backed by a map.
+type testCfg map[string]string
+
+func (c testCfg) Get() map[string]string { return c }
+
+func (c testCfg) Val() (string, bool) { return "", false }
+
+func (c testCfg) ValAsString(key, defVal string, reload ...bool) string {
+	if v, ok := c[key]; ok {
+		return v
+	}
+
+	return defVal
+}
+
+func (c testCfg) ValAsInt(key string, defVal int64, reload ...bool) int64 {
+	if i, err := strconv.ParseInt(c[key], 10, 64); err == nil {
+		return i
+	}
+
+	return defVal
+}
+
+func (c testCfg) ValAsFloat(key string, defVal float64, reload ...bool) float64 {
+	if f, err := strconv.ParseFloat(c[key], 64); err == nil {
+		return f
+	}
+
+	return defVal
+}
+
+func (c testCfg) ValAsBool(key string, defVal bool, reload ...bool) bool {
+	if b, err := strconv.ParseBool(c[key]); err == nil {
+		return b
+	}
+
+	return defVal
+}
+
+func TestConfigTopology(t *testing.T) {
+	cfg := &Config{Cfg: testCfg{
+		"rabbitmq.host":                               "localhost",
+		"rabbitmq.exchanges.events.kind":              "fanout",
+		"rabbitmq.exchanges.events.durable":           "false",
+		"rabbitmq.exchanges.orderevents.name":         "orders.events",
+		"rabbitmq.exchanges.orderevents.internal":     "true",
+		"rabbitmq.queues.orders.args.x-message-ttl":   "60000",
+		"rabbitmq.queues.orders.args.x-queue-mode":    "lazy",
+		"rabbitmq.queues.orders.args.x-single-active": "true",
+		"rabbitmq.queues.orders.exclusive":            "true",
+		"rabbitmq.queues.audit.name":                  "orders.audit",
+		"rabbitmq.bindings.ordersbinding.exchange":    "orderevents",
+		"rabbitmq.bindings.ordersbinding.queue":       "audit",
+		"rabbitmq.bindings.ordersbinding.key":         "order.*",
+		"rabbitmq.bindings.external.exchange":         "amq.topic",
+		"rabbitmq.bindings.external.queue":            "orders",
+		"rabbitmq.bindings.external.args.x-match":     "all",
+	}}
+
+	top, err := cfg.Topology()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchanges := map[string]*Exchange{}
+	for _, e := range top.Exchanges {
+		exchanges[e.Name] = e
+	}
+
+	if len(exchanges) != 2 {
+		t.Fatalf("exchanges = %v, want events and orders.events", exchanges)
+	}
+
+	if e := exchanges["events"]; e == nil || e.Kind != "fanout" || e.Durable || e.Internal {
+		t.Errorf("events exchange = %+v", e)
+	}
+
+	if e := exchanges["orders.events"]; e == nil || e.Kind != "topic" || !e.Durable || !e.Internal {
+		t.Errorf("orders.events exchange = %+v", e)
+	}
+
+	queues := map[string]*Queue{}
+	for _, q := range top.Queues {
+		queues[q.Name] = q
+	}
+
+	orders := queues["orders"]
+	if orders == nil || !orders.Durable || !orders.Exclusive {
+		t.Fatalf("orders queue = %+v", orders)
+	}
+
+	wantArgs := map[string]interface{}{
+		"x-message-ttl":   int64(60000),
+		"x-queue-mode":    "lazy",
+		"x-single-active": true,
+	}
+	if !reflect.DeepEqual(orders.ArgsTable, wantArgs) {
+		t.Errorf("orders args = %v, want %v", orders.ArgsTable, wantArgs)
+	}
+
+	if q := queues["orders.audit"]; q == nil || q.ArgsTable != nil {
+		t.Errorf("orders.audit queue = %+v", q)
+	}
+
+	bindings := map[string]*Binding{}
+	for _, b := range top.Bindings {
+		bindings[b.Name] = b
+	}
+
+	b := bindings["ordersbinding"]
+	if b == nil || b.Exchange.Name != "orders.events" || b.Queue.Name != "orders.audit" || b.RoutingKey != "order.*" {
+		t.Errorf("ordersbinding = %+v", b)
+	} else if b.Exchange != exchanges["orders.events"] || b.Queue != queues["orders.audit"] {
+		t.Error("ordersbinding does not refer to configured elements")
+	}
+
+	b = bindings["external"]
+	if b == nil || b.Exchange.Name != "amq.topic" || b.Queue != orders || b.ArgsTable["x-match"] != "all" {
+		t.Errorf("external binding = %+v", b)
+	}
+}
+
+func TestConfigTopologyIncompleteBinding(t *testing.T) {
+	cfg := &Config{Cfg: testCfg{
+		"rabbitmq.bindings.orders.exchange": "events",
+	}}
+
+	_, err := cfg.Topology()
+	if err == nil {
+		t.Error("binding without queue accepted")
+	}
+}
+
+func TestArgValue(t *testing.T) {
+	tests := []struct {
+		in   string
+		want interface{}
+	}{
+		{"60000", int64(60000)},
+		{"-1", int64(-1)},
+		{"true", true},
+		{"false", false},
+		{"1.5", "1.5"},
+		{"lazy", "lazy"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := argValue(tt.in); got != tt.want {
+			t.Errorf("argValue(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+}
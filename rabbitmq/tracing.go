@@ -0,0 +1,184 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/streadway/amqp"
+	"gitlab.com/mikrowezel/backend/broker"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of handler tracers.
+const tracerName = "gitlab.com/mikrowezel/backend/broker/rabbitmq"
+
+// Span attributes set on publish and process spans.
+const (
+	AttrSystem      = attribute.Key("messaging.system")
+	AttrOperation   = attribute.Key("messaging.operation")
+	AttrDestination = attribute.Key("messaging.destination.name")
+	AttrRoutingKey  = attribute.Key("messaging.rabbitmq.destination.routing_key")
+	AttrMessageID   = attribute.Key("messaging.message.id")
+	AttrTypeID      = attribute.Key("messaging.message.type")
+)
+
+// propagator carries trace context through AMQP headers
+// using W3C traceparent and tracestate headers.
+var propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// SetTracerProvider sets the provider of the tracer used by
+// the handler and its registered listeners and emitters.
+// Global OpenTelemetry provider is used by default.
+func (r *RabbitMQ) SetTracerProvider(tp trace.TracerProvider) {
+	t := newTracer(tp)
+
+	r.mutex.Lock()
+	r.tracer = t
+	emitters := make([]*Emitter, 0, len(r.Emitters))
+	for _, e := range r.Emitters {
+		emitters = append(emitters, e)
+	}
+
+	listeners := make([]*Listener, 0, len(r.Listeners))
+	for _, l := range r.Listeners {
+		listeners = append(listeners, l)
+	}
+	r.mutex.Unlock()
+
+	for _, e := range emitters {
+		e.setTracer(t)
+	}
+
+	for _, l := range listeners {
+		l.setTracer(t)
+	}
+}
+
+// newTracer returns the handler tracer of tp
+// or of the global provider if it is nil.
+func newTracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	return tp.Tracer(tracerName)
+}
+
+// startSpan starts the publish span of a message.
+func (e *Emitter) startSpan(ctx context.Context, msg broker.BaseMessage, routingKey string) (context.Context, trace.Span) {
+	e.hooksMutex.RLock()
+	t := e.tracer
+	e.hooksMutex.RUnlock()
+
+	return t.Start(ctx, fmt.Sprintf("%s publish", e.exchange),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			AttrSystem.String("rabbitmq"),
+			AttrOperation.String("publish"),
+			AttrDestination.String(e.exchange),
+			AttrRoutingKey.String(routingKey),
+			AttrTypeID.String(msg.TypeID()),
+		))
+}
+
+// inject propagates the trace context of a message
+// through its publishing headers.
+func (e *Emitter) inject(ebm *EmittedBaseMessage, p *amqp.Publishing) {
+	if p.Headers == nil {
+		p.Headers = amqp.Table{}
+	}
+
+	propagator.Inject(ebm.ctx, headerCarrier(p.Headers))
+
+	if p.MessageId != "" {
+		ebm.span.SetAttributes(AttrMessageID.String(p.MessageId))
+	}
+}
+
+func (e *Emitter) setTracer(t trace.Tracer) {
+	e.hooksMutex.Lock()
+	defer e.hooksMutex.Unlock()
+
+	e.tracer = t
+}
+
+// startSpan starts the process span of a delivery as a child
+// of the span propagated through its headers, if any.
+func (l *Listener) startSpan(d amqp.Delivery, typeID string) (context.Context, trace.Span) {
+	l.mutex.RLock()
+	t := l.tracer
+	ctx := l.handlerCtx
+	l.mutex.RUnlock()
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ctx = propagator.Extract(ctx, headerCarrier(d.Headers))
+
+	attrs := []attribute.KeyValue{
+		AttrSystem.String("rabbitmq"),
+		AttrOperation.String("process"),
+		AttrDestination.String(l.queue),
+		AttrRoutingKey.String(d.RoutingKey),
+		AttrTypeID.String(typeID),
+	}
+
+	if d.MessageId != "" {
+		attrs = append(attrs, AttrMessageID.String(d.MessageId))
+	}
+
+	return t.Start(ctx, fmt.Sprintf("%s process", l.queue),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...))
+}
+
+func (l *Listener) setTracer(t trace.Tracer) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.tracer = t
+}
+
+// spanError records an operation error in a span.
+func spanError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Get returns the string value of a header.
+// Byte array values, as sent by some AMQP clients,
+// are taken as strings, other types are ignored.
+func (h headerCarrier) Get(key string) string {
+	switch v := h[key].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return ""
+	}
+}
+
+// Set sets a header value.
+func (h headerCarrier) Set(key, value string) {
+	h[key] = value
+}
+
+// Keys returns header names.
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
@@ -0,0 +1,163 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/streadway/amqp"
+	"gitlab.com/mikrowezel/backend/broker"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestTracer() (trace.Tracer, *tracetest.InMemoryExporter) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	return newTracer(tp), exp
+}
+
+func TestInjectExtract(t *testing.T) {
+	tracer, _ := newTestTracer()
+
+	ctx, span := tracer.Start(context.Background(), "test")
+	defer span.End()
+
+	sc := span.SpanContext()
+	p := amqp.Publishing{}
+	e := &Emitter{tracer: tracer}
+	e.inject(&EmittedBaseMessage{ctx: ctx, span: span}, &p)
+
+	want := fmt.Sprintf("00-%s-%s-01", sc.TraceID(), sc.SpanID())
+	if got := p.Headers["traceparent"]; got != want {
+		t.Fatalf("traceparent = %v, want %s", got, want)
+	}
+
+	got := trace.SpanContextFromContext(propagator.Extract(context.Background(), headerCarrier(p.Headers)))
+	if !got.IsRemote() {
+		t.Error("extracted span context is not remote")
+	}
+
+	if got.TraceID() != sc.TraceID() || got.SpanID() != sc.SpanID() || got.TraceFlags() != sc.TraceFlags() {
+		t.Errorf("extracted %v, want %v", got, sc)
+	}
+}
+
+func TestHeaderCarrierGet(t *testing.T) {
+	const traceparent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+	tests := []struct {
+		name   string
+		value  interface{}
+		want   string
+		remote bool
+	}{
+		{"string", traceparent, traceparent, true},
+		{"byte array", []byte(traceparent), traceparent, true},
+		{"integer", int64(1), "", false},
+		{"table", amqp.Table{"traceparent": traceparent}, "", false},
+		{"nil", nil, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := headerCarrier(amqp.Table{"traceparent": tt.value})
+			if got := h.Get("traceparent"); got != tt.want {
+				t.Errorf("Get() = %q, want %q", got, tt.want)
+			}
+
+			sc := trace.SpanContextFromContext(propagator.Extract(context.Background(), h))
+			if sc.IsRemote() != tt.remote {
+				t.Errorf("extracted remote = %t, want %t", sc.IsRemote(), tt.remote)
+			}
+		})
+	}
+}
+
+func TestProcessSpanParent(t *testing.T) {
+	tracer, exp := newTestTracer()
+
+	e := &Emitter{exchange: "events", tracer: tracer}
+	ctx, span := e.startSpan(context.Background(), broker.NewText("hello"), "orders")
+
+	ebm := &EmittedBaseMessage{ctx: ctx, span: span}
+	p := amqp.Publishing{MessageId: "message-1"}
+	e.inject(ebm, &p)
+	span.End()
+
+	l := &Listener{queue: "orders", tracer: tracer, handlerCtx: context.Background()}
+	d := amqp.Delivery{Headers: p.Headers, MessageId: p.MessageId, RoutingKey: "orders"}
+	_, ps := l.startSpan(d, "text")
+	ps.End()
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+
+	publish, process := spans[0], spans[1]
+
+	if publish.SpanKind != trace.SpanKindProducer {
+		t.Errorf("publish span kind = %s", publish.SpanKind)
+	}
+
+	if process.SpanKind != trace.SpanKindConsumer {
+		t.Errorf("process span kind = %s", process.SpanKind)
+	}
+
+	if process.Parent.SpanID() != publish.SpanContext.SpanID() {
+		t.Errorf("process span parent = %s, want %s", process.Parent.SpanID(), publish.SpanContext.SpanID())
+	}
+
+	if process.SpanContext.TraceID() != publish.SpanContext.TraceID() {
+		t.Errorf("process trace = %s, want %s", process.SpanContext.TraceID(), publish.SpanContext.TraceID())
+	}
+
+	if !process.Parent.IsRemote() {
+		t.Error("process span parent is not remote")
+	}
+}
+
+func TestRetryKeepsTraceContext(t *testing.T) {
+	tracer, exp := newTestTracer()
+
+	e := &Emitter{exchange: "events", tracer: tracer}
+	ctx, span := e.startSpan(context.Background(), broker.NewText("hello"), "orders")
+
+	p := amqp.Publishing{MessageId: "message-1"}
+	e.inject(&EmittedBaseMessage{ctx: ctx, span: span}, &p)
+	span.End()
+
+	l := &Listener{queue: "orders", tracer: tracer, handlerCtx: context.Background()}
+	d := amqp.Delivery{Headers: p.Headers, MessageId: p.MessageId}
+
+	_, first := l.startSpan(d, "text")
+	first.End()
+
+	// A retried message comes back from the retry queue as a copy.
+	rp := republishing(d)
+	rp.Headers[RetryAttemptHeader] = int64(1)
+
+	_, retried := l.startSpan(amqp.Delivery{Headers: rp.Headers, MessageId: rp.MessageId}, "text")
+	retried.End()
+
+	spans := exp.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("exported %d spans, want 3", len(spans))
+	}
+
+	publish := spans[0].SpanContext
+	for _, s := range spans[1:] {
+		if s.Parent.SpanID() != publish.SpanID() || s.SpanContext.TraceID() != publish.TraceID() {
+			t.Errorf("span %s parent = %s, want publish span %s", s.Name, s.Parent.SpanID(), publish.SpanID())
+		}
+	}
+
+	// Retry headers must not reach the handler as message headers.
+	m := &broker.Message{}
+	fillEnvelope(m, amqp.Delivery{Headers: rp.Headers})
+	if len(m.Headers) != 0 {
+		t.Errorf("message headers = %v, want none", m.Headers)
+	}
+}
@@ -3,12 +3,15 @@ package rabbitmq
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/streadway/amqp"
 	"gitlab.com/mikrowezel/backend/broker"
 	"gitlab.com/mikrowezel/backend/broker/mapper"
+	"gitlab.com/mikrowezel/backend/broker/metrics"
 	"gitlab.com/mikrowezel/backend/log"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Cfg interface
@@ -28,31 +31,50 @@ type Config struct {
 
 // RabbitMQ is message broker handler.
 type RabbitMQ struct {
+	mutex     sync.RWMutex
 	ctx       context.Context
 	cfg       *Config
 	log       *log.Logger
+	metrics   metrics.Metrics
+	tracer    trace.Tracer
 	name      string
 	ready     bool
 	alive     bool
 	conn      *amqp.Connection
-	Channels  map[*Channel]bool
+	closed    bool
+	Channels  *ChannelPool
 	Exchanges map[string]*Exchange
 	Queues    map[string]*Queue
 	Bindings  map[string]*Binding
 	Listeners map[string]*Listener
 	Emitters  map[string]*Emitter
+	alerts    []*queueAlert
+	statsStop chan struct{}
+	done      chan struct{}
 }
 
 // Channel lets the broker client
 // handle RabbitMQ channels.
 type Channel struct {
 	mutex   *sync.Mutex
+	conn    *amqp.Connection
 	ID      uuid.UUID
 	Name    string
 	Channel *amqp.Channel
 	IsOpen  bool
 }
 
+// ChannelPool is a bounded pool of channels
+// that can be safely shared between goroutines.
+type ChannelPool struct {
+	mutex  sync.Mutex
+	conn   *amqp.Connection
+	idle   []*Channel
+	slots  chan struct{}
+	closed bool
+	log    *log.Logger
+}
+
 // Exchange lets the broker client
 // handle RabbitMQ exchanges.
 type Exchange struct {
@@ -70,41 +92,215 @@ type Exchange struct {
 // Queue lets the broker client
 // handle RabbitMQ queues.
 type Queue struct {
-	ID        string
+	mutex      sync.RWMutex
+	ID         string
+	Name       string
+	Durable    bool
+	AutoDelete bool
+	Exclusive  bool
+	NoWait     bool
+	ArgsTable  map[string]interface{}
+	Messages   int
+	Consumers  int
+	updatedAt  time.Time
+	log        *log.Logger
+}
+
+// QueueStats are queue message and consumer counts.
+type QueueStats struct {
 	Name      string
 	Messages  int
 	Consumers int
-	log       *log.Logger
+	UpdatedAt time.Time
 }
 
+// QueueAlert is called when a queue crosses a threshold.
+type QueueAlert func(stats QueueStats)
+
+type queueAlert struct {
+	queue     string
+	threshold int
+	triggered bool
+	fn        QueueAlert
+}
+
+// QueueOptions are the properties
+// used to declare a queue.
+type QueueOptions = broker.QueueOptions
+
 // Binding lets the broker client
 // handle bindings between exchanges and queues.
 type Binding struct {
-	ID       string
-	Name     string
-	Exchange *Exchange
-	Queue    *Queue
+	ID         string
+	Name       string
+	Exchange   *Exchange
+	Queue      *Queue
+	RoutingKey string
+	ArgsTable  map[string]interface{}
+}
+
+// Status is a report of the handler state.
+type Status = broker.Status
+
+// ChannelsStatus reports handler channel pool usage.
+type ChannelsStatus = broker.ChannelsStatus
+
+// ListenerStatus reports the state of a listener.
+type ListenerStatus = broker.ListenerStatus
+
+// EmitterStatus reports the state of an emitter.
+type EmitterStatus = broker.EmitterStatus
+
+// ShutdownError reports what was left unfinished
+// when the handler was shut down.
+type ShutdownError struct {
+	Listeners []string
+	Emitters  []string
+	Pending   int
+	Errors    []error
+}
+
+// Topology describes a set of exchanges,
+// queues and bindings.
+type Topology struct {
+	Exchanges []*Exchange
+	Queues    []*Queue
+	Bindings  []*Binding
+}
+
+// Definitions is the topology subset of
+// RabbitMQ definitions.json schema.
+type Definitions struct {
+	Exchanges []ExchangeDefinition `json:"exchanges"`
+	Queues    []QueueDefinition    `json:"queues"`
+	Bindings  []BindingDefinition  `json:"bindings"`
+}
+
+// ExchangeDefinition is a definitions.json exchange.
+type ExchangeDefinition struct {
+	Name       string                 `json:"name"`
+	VHost      string                 `json:"vhost"`
+	Type       string                 `json:"type"`
+	Durable    bool                   `json:"durable"`
+	AutoDelete bool                   `json:"auto_delete"`
+	Internal   bool                   `json:"internal"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
+// QueueDefinition is a definitions.json queue.
+type QueueDefinition struct {
+	Name       string                 `json:"name"`
+	VHost      string                 `json:"vhost"`
+	Durable    bool                   `json:"durable"`
+	AutoDelete bool                   `json:"auto_delete"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
+// BindingDefinition is a definitions.json binding.
+type BindingDefinition struct {
+	Source          string                 `json:"source"`
+	VHost           string                 `json:"vhost"`
+	Destination     string                 `json:"destination"`
+	DestinationType string                 `json:"destination_type"`
+	RoutingKey      string                 `json:"routing_key"`
+	Arguments       map[string]interface{} `json:"arguments"`
 }
 
 // Emitter is a RabbitMQ message emitter.
 type Emitter struct {
-	connection *amqp.Connection
-	exchange   string
-	events     chan *EmittedBaseMessage
-	log        *log.Logger
+	mutex          sync.Mutex
+	connection     *amqp.Connection
+	channel        *amqp.Channel
+	exchange       string
+	eventsMutex    sync.RWMutex
+	events         chan *EmittedBaseMessage
+	closed         bool
+	closing        chan struct{}
+	closingOnce    sync.Once
+	stopped        chan struct{}
+	resumed        chan struct{}
+	confirmTimeout time.Duration
+	tracker        *confirmTracker
+	mandatory      bool
+	hooksMutex     sync.RWMutex
+	onReturn       ReturnHandler
+	metrics        metrics.Metrics
+	tracer         trace.Tracer
+	log            *log.Logger
 }
 
 // Listener is a RabbitMQ message listener.
 type Listener struct {
-	connection *amqp.Connection
-	exchange   string
-	queue      string
-	mapper     mapper.BaseMessageMapper
-	log        *log.Logger
+	mutex                sync.RWMutex
+	ctx                  context.Context
+	handlerCtx           context.Context
+	owner                *RabbitMQ
+	connection           *amqp.Connection
+	declared             []*Queue
+	consumers            []*consumer
+	exchange             string
+	queue                string
+	mapper               mapper.BaseMessageMapper
+	handlers             map[string]broker.Handler
+	fallback             broker.Handler
+	deadLetterExchange   string
+	deadLetterRoutingKey string
+	retryDelays          []time.Duration
+	retryMutex           sync.Mutex
+	retryPub             *retryPublisher
+	ackMode              AckMode
+	classifier           Classifier
+	concurrency          int
+	active               int
+	metrics              metrics.Metrics
+	tracer               trace.Tracer
+	prefetchCount        int
+	prefetchSize         int
+	wg                   sync.WaitGroup
+	stopped              chan struct{}
+	done                 chan struct{}
+	resumed              chan struct{}
+	log                  *log.Logger
+}
+
+// retryPublisher is a confirm mode channel used by a listener
+// to send messages to its retry and parking queues.
+type retryPublisher struct {
+	channel  *amqp.Channel
+	confirms chan amqp.Confirmation
+	returns  chan amqp.Return
+	closed   chan *amqp.Error
+}
+
+// consumer is a listener consumer.
+type consumer struct {
+	channel *amqp.Channel
+	tag     string
 }
 
 // EmittedBaseMessage is an emitted base message.
 type EmittedBaseMessage struct {
-	event     broker.BaseMessage
-	errorChan chan error
+	emitter    *Emitter
+	ctx        context.Context
+	event      broker.BaseMessage
+	routingKey string
+	messageID  string
+	pending    bool
+	returned   *ErrUnroutable
+	timer      *time.Timer
+	span       trace.Span
+	errorChan  chan error
+	once       sync.Once
+}
+
+// headerCarrier propagates trace context through AMQP headers.
+type headerCarrier amqp.Table
+
+// confirmTracker tracks messages published
+// on a channel in confirm mode.
+type confirmTracker struct {
+	mutex   sync.Mutex
+	tag     uint64
+	timeout time.Duration
+	pending map[uint64]*EmittedBaseMessage
 }
@@ -1,17 +1,113 @@
 package broker
 
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
 // BaseMessage is a base broker message interface.
 type BaseMessage interface {
 	TypeID() string
 }
 
 // Message is a BaseMessage referecence implementation.
+// It is a standard envelope for an arbitrary JSON payload.
 type Message struct {
+	ID            string            `json:"id"`
+	Type          string            `json:"type,omitempty"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	CorrelationID string            `json:"correlationID,omitempty"`
+	CausationID   string            `json:"causationID,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Payload       json.RawMessage   `json:"payload,omitempty"`
 }
 
 // Text is a BaseMessage referecence implementation.
 // for sending plain text.
 type Text struct {
+	Body     string `json:"body"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// QueueOptions are the properties
+// used to declare a queue.
+type QueueOptions struct {
+	Durable    bool
+	AutoDelete bool
+	Exclusive  bool
+	NoWait     bool
+	Args       map[string]interface{}
+}
+
+// Status is a report of a broker handler state.
+type Status struct {
+	Name      string           `json:"name"`
+	Alive     bool             `json:"alive"`
+	Ready     bool             `json:"ready"`
+	Connected bool             `json:"connected"`
+	Topology  bool             `json:"topologyDeclared"`
+	Channels  ChannelsStatus   `json:"channels"`
+	Listeners []ListenerStatus `json:"listeners"`
+	Emitters  []EmitterStatus  `json:"emitters"`
+}
+
+// ChannelsStatus reports broker handler channel pool usage.
+type ChannelsStatus struct {
+	Open  bool `json:"open"`
+	Size  int  `json:"size"`
+	InUse int  `json:"inUse"`
+}
+
+// ListenerStatus reports the state of a listener.
+type ListenerStatus struct {
+	Name      string `json:"name"`
+	Exchange  string `json:"exchange"`
+	Queue     string `json:"queue"`
+	Started   bool   `json:"started"`
+	Consuming bool   `json:"consuming"`
+	Consumers int    `json:"consumers"`
+}
+
+// EmitterStatus reports the state of an emitter.
+type EmitterStatus struct {
+	Name     string `json:"name"`
+	Exchange string `json:"exchange"`
+	Closed   bool   `json:"closed"`
+	Queued   int    `json:"queued"`
+	Pending  int    `json:"pendingConfirms"`
+}
+
+// NewMessage returns a new Message envelope.
+// Type identifies the payload kind carried by the envelope
+// and payload is serialized as JSON.
+func NewMessage(typ string, payload interface{}) (*Message, error) {
+	p, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		ID:        uuid.New().String(),
+		Type:      typ,
+		CreatedAt: time.Now().UTC(),
+		Headers:   make(map[string]string),
+		Payload:   p,
+	}, nil
+}
+
+// NewText returns a new UTF-8 encoded Text.
+func NewText(body string) *Text {
+	return &Text{
+		Body:     body,
+		Encoding: "utf-8",
+	}
+}
+
+// Decode unmarshals Message payload into v.
+func (m *Message) Decode(v interface{}) error {
+	return json.Unmarshal(m.Payload, v)
 }
 
 // TypeID returns Message type id.